@@ -34,7 +34,7 @@ func main() {
 
 	if len(country) == 0 || len(file) == 0 {
 		port := os.Getenv("PORT")
-		zilch.StartServer("resources", port)
+		zilch.StartServer("resources", port, os.Getenv("API_KEY_FILE"))
 	} else {
 		file, err := os.Open(file)
 		defer file.Close()
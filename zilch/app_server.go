@@ -2,13 +2,15 @@ package zilch
 
 import (
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/hoisie/web"
 )
 
-// StartServer starts the Zilch Web Server.
-func StartServer(resourceDir, port string) {
+// StartServer starts the Zilch Web Server. When there is an API key file,
+// every request is limited by the RateLimitConfig in the file.
+func StartServer(resourceDir, port, apiKeyFile string) {
 	start := time.Now()
 	database, _ := NewDatabase(resourceDir)
 
@@ -19,16 +21,43 @@ func StartServer(resourceDir, port string) {
 	web.Get("/", sc.RenderRoot)
 	web.Get("/query\\.?(.*)", zcc.Query)
 	web.Post("/query\\.?(.*)", zcc.Query)
+	web.Get("/suggest\\.?(.*)", zcc.Suggest)
+	web.Post("/suggest\\.?(.*)", zcc.Suggest)
+	web.Post("/batch\\.?(.*)", zcc.BatchLookup)
+	web.Get("/validate/format\\.?(.*)", zcc.ValidateFormat)
+	web.Post("/validate/format\\.?(.*)", zcc.ValidateFormat)
+	web.Get("/validate\\.?(.*)", zcc.Validate)
+	web.Post("/validate\\.?(.*)", zcc.Validate)
+	web.Get("/normalize\\.?(.*)", zcc.Normalize)
+	web.Post("/normalize\\.?(.*)", zcc.Normalize)
 	web.Get("/distribution\\.?(.*)", zcc.GetDistribution)
 	web.Post("/distribution\\.?(.*)", zcc.GetDistribution)
+	web.Get("/countries/([A-Za-z]{2})/states/([^/.]+)/counties\\.?(.*)", zcc.GetCounties)
+	web.Get("/countries/([A-Za-z]{2})/states/([^/.]+)/cities\\.?(.*)", zcc.GetCities)
+	web.Get("/countries/([A-Za-z]{2})/states/([^/.]+)\\.?(.*)", zcc.GetState)
+	web.Get("/countries/([A-Za-z]{2})\\.?(.*)", zcc.GetCountry)
+	web.Get("/zip/([A-Za-z]{2})/([^/.]+)\\.?(.*)", zcc.GetZipCode)
 	web.Get("/countries\\.?(.*)", zcc.GetCountries)
 	web.Post("/countries\\.?(.*)", zcc.GetCountries)
+	web.Get("/stats\\.?(.*)", zcc.GetCacheStats)
 	web.Get("/map_(\\d*)\\.png", pc.RenderImage)
 	web.Get("/distmap_(\\d*)\\.png", pc.RenderDistributionImage)
 	web.Get("/images/(.*)", sc.RenderImages)
 	web.Get("/js/(.*)", sc.RenderJS)
 	web.Get("/(.*)", sc.RenderHTML)
 
-	fmt.Printf("Server started on port %v in %v\n", port, time.Since(start))
-	web.Run("0.0.0.0:" + port)
+	if len(apiKeyFile) == 0 {
+		fmt.Printf("Server started on port %v in %v\n", port, time.Since(start))
+		web.Run("0.0.0.0:" + port)
+		return
+	}
+
+	config, err := LoadRateLimitConfig(apiKeyFile)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Server started on port %v in %v with %v API keys\n", port, time.Since(start), len(config.Keys))
+	if err := http.ListenAndServe("0.0.0.0:"+port, NewRateLimiter(config).Handler(http.HandlerFunc(web.Process))); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,171 @@
+package zilch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxBatchLookups int = 200000
+)
+
+// BatchLookup is a single country and zip code pair to look up as part of
+// a batch.
+type BatchLookup struct {
+	Country string
+	ZipCode string
+}
+
+// BatchResult is the result of a single BatchLookup. Found is false when no
+// zip code matched, in which case ZipCodeEntries is empty. PartialMatch is
+// true when only the outward part of the zip code matched, such as the FSA
+// of a Canadian postal code.
+type BatchResult struct {
+	Country        string
+	ZipCode        string
+	Found          bool
+	PartialMatch   bool
+	ZipCodeEntries []ZipEntry
+}
+
+// BatchResultMarshaller is used to marshal BatchResult objects.
+type BatchResultMarshaller []BatchResult
+
+var batchZipCleaner = regexp.MustCompile("[^0-9A-Za-z]")
+
+func batchZipKey(zipCode string) string {
+	return strings.ToLower(batchZipCleaner.ReplaceAllString(zipCode, ""))
+}
+
+// ReadBatchLookupsJSON reads a JSON array of BatchLookup objects.
+func ReadBatchLookupsJSON(r io.Reader) ([]BatchLookup, error) {
+	lookups := make([]BatchLookup, 0, 100)
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&lookups); err != nil {
+		return nil, badRequestError(ErrorInvalidBatch, "Invalid batch: %v", err)
+	}
+	if len(lookups) > maxBatchLookups {
+		return nil, badRequestError(ErrorInvalidBatch, "Too many lookups in batch: %v", len(lookups))
+	}
+	return lookups, nil
+}
+
+// ReadBatchLookupsCSV reads a CSV file of country and zip code pairs. The
+// first row must be a header containing a "zip" or "ZipCode" column, and
+// optionally a "country" column. When there is no country column the
+// default country is used for every row.
+func ReadBatchLookupsCSV(r io.Reader, defaultCountry string) ([]BatchLookup, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, badRequestError(ErrorInvalidBatch, "The batch file is empty")
+	} else if err != nil {
+		return nil, badRequestError(ErrorInvalidBatch, "Invalid batch file: %v", err)
+	}
+	zipCol, countryCol := -1, -1
+	for i, col := range header {
+		switch strings.ToLower(strings.TrimSpace(col)) {
+		case "zip", "zipcode", "zip_code":
+			zipCol = i
+		case "country":
+			countryCol = i
+		}
+	}
+	if zipCol == -1 {
+		return nil, badRequestError(ErrorInvalidBatch, "The batch file has no zip column")
+	}
+	if countryCol == -1 && len(defaultCountry) == 0 {
+		return nil, badRequestError(ErrorInvalidBatch, "The batch file has no country column")
+	}
+
+	lookups := make([]BatchLookup, 0, 100)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, badRequestError(ErrorInvalidBatch, "Invalid batch file: %v", err)
+		}
+		lookup := BatchLookup{Country: defaultCountry}
+		if zipCol < len(record) {
+			lookup.ZipCode = record[zipCol]
+		}
+		if countryCol != -1 && countryCol < len(record) && len(record[countryCol]) > 0 {
+			lookup.Country = record[countryCol]
+		}
+		lookups = append(lookups, lookup)
+		if len(lookups) > maxBatchLookups {
+			return nil, badRequestError(ErrorInvalidBatch, "Too many lookups in batch: %v", len(lookups))
+		}
+	}
+	return lookups, nil
+}
+
+// BatchLookup finds the zip code entries for each of the lookups. The
+// results are returned in the same order as the lookups.
+func (d *Database) BatchLookup(lookups []BatchLookup) []BatchResult {
+	results := make([]BatchResult, len(lookups))
+	for i, lookup := range lookups {
+		country := strings.ToUpper(strings.TrimSpace(lookup.Country))
+		entries, partial := make([]ZipEntry, 0, 1), false
+		if countryIndex, found := d.CountryIndexMap[country]; found {
+			entries, partial = countryIndex.matchZipCode(lookup.ZipCode)
+		}
+		results[i] = BatchResult{
+			Country:        lookup.Country,
+			ZipCode:        lookup.ZipCode,
+			Found:          len(entries) > 0,
+			PartialMatch:   partial,
+			ZipCodeEntries: entries,
+		}
+	}
+	return results
+}
+
+func (c *CountryIndex) buildZipIndex() {
+	c.zipIndex = make(map[string][]int)
+	for i, entry := range c.Entries {
+		key := batchZipKey(entry.ZipCode)
+		c.zipIndex[key] = append(c.zipIndex[key], i)
+	}
+}
+
+// matchZipCode finds the entries of the zip code. When it is not in the
+// database, a full code of a country which only holds outward codes matches
+// the entries of its outward part, and the match is partial.
+func (c CountryIndex) matchZipCode(zipCode string) ([]ZipEntry, bool) {
+	if entries := c.findZipCode(zipCode); len(entries) > 0 {
+		return entries, false
+	}
+	if outward, found := outwardPostalCode(c.CountryCode, zipCode); found {
+		if entries := c.findZipCode(outward); len(entries) > 0 {
+			return entries, true
+		}
+	}
+	return make([]ZipEntry, 0, 1), false
+}
+
+func (c CountryIndex) findZipCode(zipCode string) []ZipEntry {
+	key := batchZipKey(zipCode)
+	entries := make([]ZipEntry, 0, 1)
+	if len(key) == 0 {
+		return entries
+	}
+	if c.zipIndex == nil {
+		for _, entry := range c.Entries {
+			if batchZipKey(entry.ZipCode) == key {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+	for _, idx := range c.zipIndex[key] {
+		entries = append(entries, c.Entries[idx])
+	}
+	return entries
+}
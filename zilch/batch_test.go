@@ -0,0 +1,65 @@
+package zilch
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_BatchLookup(t *testing.T) {
+	index := CountryIndex{
+		CountryCode: "CA",
+		Entries: []ZipEntry{
+			ZipEntry{ZipCode: "T0A", City: "Eastern Alberta", Country: "CA"},
+			ZipEntry{ZipCode: "T0B", City: "Wainwright Region", Country: "CA"},
+		},
+	}
+	index.buildZipIndex()
+	database := &Database{CountryIndexMap: map[string]CountryIndex{"CA": index}}
+
+	lookups, err := ReadBatchLookupsJSON(strings.NewReader(`[{"Country":"CA","ZipCode":"t0b"},{"Country":"CA","ZipCode":"X9X"},{"Country":"ca","ZipCode":"T0A"}]`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	results := database.BatchLookup(lookups)
+	if len(results) != 3 {
+		t.Errorf("Expected 3 results, found %v", len(results))
+		return
+	}
+	if !results[0].Found || results[0].ZipCode != "t0b" || results[0].ZipCodeEntries[0].City != "Wainwright Region" {
+		t.Errorf("Wrong first result: %v", results[0])
+	}
+	if results[1].Found || len(results[1].ZipCodeEntries) != 0 {
+		t.Errorf("Second result should not be found: %v", results[1])
+	}
+	if !results[2].Found || results[2].PartialMatch || results[2].ZipCodeEntries[0].ZipCode != "T0A" {
+		t.Errorf("Wrong third result: %v", results[2])
+	}
+
+	// full codes match the FSA which the database holds
+	results = database.BatchLookup([]BatchLookup{{"CA", "T0A 1A0"}, {"CA", "t0b-1b0"}, {"CA", "T0A 1A"}, {"CA", "X9X 1A0"}})
+	if !results[0].Found || !results[0].PartialMatch || results[0].ZipCode != "T0A 1A0" || results[0].ZipCodeEntries[0].ZipCode != "T0A" {
+		t.Errorf("Wrong result for a full code: %v", results[0])
+	}
+	if !results[1].Found || !results[1].PartialMatch || results[1].ZipCodeEntries[0].City != "Wainwright Region" {
+		t.Errorf("Wrong result for a full code: %v", results[1])
+	}
+	if results[2].Found || results[2].PartialMatch || results[3].Found || results[3].PartialMatch {
+		t.Errorf("Codes which are not full codes of a known FSA should not be found: %v", results[2:])
+	}
+}
+
+func Test_ReadBatchLookupsCSV(t *testing.T) {
+	lookups, err := ReadBatchLookupsCSV(strings.NewReader("name,zip,country\nA,T0A,CA\nB,22151,\n"), "US")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(lookups) != 2 || lookups[0] != (BatchLookup{"CA", "T0A"}) || lookups[1] != (BatchLookup{"US", "22151"}) {
+		t.Errorf("Wrong lookups: %v", lookups)
+	}
+
+	if _, err := ReadBatchLookupsCSV(strings.NewReader("name,zip\nA,T0A\n"), ""); err == nil {
+		t.Error("Expected an error for a missing country column")
+	}
+}
@@ -0,0 +1,99 @@
+package zilch
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl lets clients and proxies reuse a response for an hour, after
+// which they revalidate it with its ETag or Last-Modified date.
+const cacheControl = "public, max-age=3600"
+
+// notModified sets the caching headers of a GET response which only changes
+// with the version, and sends a 304 Not Modified when the conditional headers
+// of the request show that the client already has it. If-None-Match takes
+// precedence over If-Modified-Since. The returned flag is true when the 304
+// was sent.
+func (writer ResponseWriter) notModified(version string, modified time.Time) bool {
+	request := writer.ctx.Request
+	if request.Method != "GET" && request.Method != "HEAD" {
+		return false
+	}
+
+	header := writer.ctx.ResponseWriter.Header()
+	etag := writer.etag(version)
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl)
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if len(writer.format) == 0 {
+		header.Set("Vary", "Accept")
+	}
+
+	if match := request.Header.Get("If-None-Match"); len(match) > 0 {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+	writer.ctx.NotModified()
+	return true
+}
+
+// databaseNotModified sends a 304 Not Modified when the client already has
+// the response for the current version of the database. Nothing is cached
+// while the database is still being read.
+func (writer ResponseWriter) databaseNotModified(d *Database) bool {
+	if !d.IsFullyLoaded() {
+		writer.ctx.ResponseWriter.Header().Set("Cache-Control", "no-cache")
+		return false
+	}
+	return writer.notModified(d.Version, d.Modified)
+}
+
+// etag gets the entity tag of the response, from the version, the path and
+// the query parameters. Without a file extension the Accept header is also
+// included, since it picks the format. The tag is weak, as the response may
+// or may not be gzipped.
+func (writer ResponseWriter) etag(version string) string {
+	request := writer.ctx.Request
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s\n", request.URL.Path)
+
+	query := request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", key, strings.Join(query[key], ","))
+	}
+	if len(writer.format) == 0 {
+		fmt.Fprintf(hash, "Accept: %s\n", request.Header.Get("Accept"))
+	}
+	return fmt.Sprintf("W/\"%s-%s\"", version, strconv.FormatUint(hash.Sum64(), 36))
+}
+
+// etagMatches determines whether an If-None-Match header matches the entity
+// tag, using the weak comparison.
+func etagMatches(match, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
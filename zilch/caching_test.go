@@ -0,0 +1,141 @@
+package zilch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hoisie/web"
+)
+
+func testCachedWriter(url, format string, headers map[string]string) (ResponseWriter, *httptest.ResponseRecorder) {
+	request, _ := http.NewRequest("GET", url, nil)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	return ResponseWriter{&web.Context{Request: request, ResponseWriter: recorder}, format}, recorder
+}
+
+func Test_ResponseWriter_NotModified(t *testing.T) {
+	modified := time.Date(2015, 3, 1, 12, 30, 15, 500, time.UTC)
+
+	writer, recorder := testCachedWriter("/countries.json", "json", nil)
+	if writer.notModified("v1", modified) {
+		t.Error("Unexpected 304 without conditional headers")
+	}
+	etag := recorder.Header().Get("ETag")
+	if len(etag) == 0 || recorder.Header().Get("Last-Modified") != "Sun, 01 Mar 2015 12:30:15 GMT" ||
+		recorder.Header().Get("Cache-Control") != cacheControl {
+		t.Errorf("Wrong caching headers %v", recorder.Header())
+	}
+
+	tests := []struct {
+		headers  map[string]string
+		expected bool
+	}{
+		{map[string]string{"If-None-Match": etag}, true},
+		{map[string]string{"If-None-Match": `"other", ` + etag[2:]}, true},
+		{map[string]string{"If-None-Match": "*"}, true},
+		{map[string]string{"If-None-Match": `W/"other"`}, false},
+		{map[string]string{"If-Modified-Since": "Sun, 01 Mar 2015 12:30:15 GMT"}, true},
+		{map[string]string{"If-Modified-Since": "Sun, 01 Mar 2015 12:30:14 GMT"}, false},
+		{map[string]string{"If-Modified-Since": "yesterday"}, false},
+		// If-None-Match wins over If-Modified-Since
+		{map[string]string{"If-None-Match": `W/"other"`, "If-Modified-Since": "Mon, 02 Mar 2015 00:00:00 GMT"}, false},
+	}
+	for _, test := range tests {
+		writer, recorder := testCachedWriter("/countries.json", "json", test.headers)
+		if found := writer.notModified("v1", modified); found != test.expected {
+			t.Errorf("Wrong result for %v: %v", test.headers, found)
+		} else if found && recorder.Code != 304 {
+			t.Errorf("Expected a 304, found %v", recorder.Code)
+		}
+	}
+
+	// a new version of the data changes the tag
+	writer, _ = testCachedWriter("/countries.json", "json", map[string]string{"If-None-Match": etag})
+	if writer.notModified("v2", modified) {
+		t.Error("Unexpected 304 for a new version")
+	}
+}
+
+func Test_ResponseWriter_ETag(t *testing.T) {
+	etag := func(url, format, accept string) string {
+		writer, _ := testCachedWriter(url, format, map[string]string{"Accept": accept})
+		return writer.etag("v1")
+	}
+
+	if etag("/query.json?Country=JP&City=Chiyoda", "json", "") != etag("/query.json?City=Chiyoda&Country=JP", "json", "text/xml") {
+		t.Error("Expected the same tag for the same query")
+	}
+	if etag("/query.json?Country=JP", "json", "") == etag("/query.json?Country=US", "json", "") {
+		t.Error("Expected a different tag for a different query")
+	}
+	if etag("/query.json?Country=JP", "json", "") == etag("/query.xml?Country=JP", "xml", "") {
+		t.Error("Expected a different tag for a different format")
+	}
+	if etag("/query?Country=JP", "", "text/yaml") == etag("/query?Country=JP", "", "text/xml") {
+		t.Error("Expected a different tag for a different Accept header")
+	}
+}
+
+func Test_Controller_Caching(t *testing.T) {
+	database := testRegionDatabase()
+	database.Version = "v1"
+	database.FullyLoaded = true
+	c := ZipCodeController{database}
+
+	writer, recorder := testCachedWriter("/countries/US.json", "json", nil)
+	c.GetCountry(writer.ctx, "US", "json")
+	etag := recorder.Header().Get("ETag")
+	if recorder.Code != 200 || len(etag) == 0 {
+		t.Errorf("Wrong response %v %v", recorder.Code, recorder.Header())
+	}
+
+	writer, recorder = testCachedWriter("/countries/US.json", "json", map[string]string{"If-None-Match": etag})
+	c.GetCountry(writer.ctx, "US", "json")
+	if recorder.Code != 304 || recorder.Body.Len() > 0 {
+		t.Errorf("Expected a 304, found %v: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// the local time changes, so it is never cached
+	writer, recorder = testCachedWriter("/query.json?Country=US&localtime=true", "json", map[string]string{"If-None-Match": "*"})
+	c.Query(writer.ctx, "json")
+	if recorder.Code != 200 || len(recorder.Header().Get("ETag")) > 0 || recorder.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Wrong response %v %v", recorder.Code, recorder.Header())
+	}
+
+	database.FullyLoaded = false
+	writer, recorder = testCachedWriter("/map_5.png", "", map[string]string{"If-None-Match": "*"})
+	if writer.databaseNotModified(database) || len(recorder.Header().Get("ETag")) > 0 {
+		t.Errorf("Unexpected caching while loading %v", recorder.Header())
+	}
+}
+
+func Test_ResponseWriter_SendError_Not_Cached(t *testing.T) {
+	writer, recorder := testCachedWriter("/countries.json", "json", nil)
+	writer.notModified("v1", time.Now())
+	writer.SendError(os.ErrPermission)
+	if recorder.Code != 500 || len(recorder.Header().Get("ETag")) > 0 || recorder.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Wrong error response %v %v", recorder.Code, recorder.Header())
+	}
+}
+
+func Test_Dataset_Version(t *testing.T) {
+	files, err := ioutil.ReadDir("../resources")
+	if err != nil {
+		t.Skip(err)
+	}
+	version, modified := datasetVersion(files)
+	again, _ := datasetVersion(files)
+	if len(version) == 0 || version != again || modified.IsZero() {
+		t.Errorf("Wrong version %v %v", version, modified)
+	}
+	if other, _ := datasetVersion(files[1:]); other == version {
+		t.Error("Expected a different version for different files")
+	}
+}
@@ -0,0 +1,443 @@
+// Package client is a Go client for the Zilch web service. The query,
+// distribution and country responses may be requested in any format the
+// server supports, and are decoded back into the zilch data objects.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rchargel/zilch/zilch"
+)
+
+const (
+	defaultTimeout   = 30 * time.Second
+	defaultRetries   = 2
+	defaultRetryWait = 250 * time.Millisecond
+)
+
+// Client talks to a Zilch server. The zero values of Timeout, Retries and
+// RetryWait disable the timeout, the retries and the wait between retries.
+type Client struct {
+	// BaseURL is the address of the server, such as "http://localhost:8080".
+	BaseURL string
+	// HTTPClient sends the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// APIKey is sent with every request when the server requires one.
+	APIKey string
+	// Format is the response format of the Query, Distribution and Countries
+	// methods. Query supports JSON, XML, YAML, MSGPACK, GEOJSON, CSV, TSV, KML
+	// and GPX, the others support JSON, XML, YAML, MSGPACK and GEOJSON.
+	Format string
+	// Timeout limits each attempt of a request.
+	Timeout time.Duration
+	// Retries is the number of times a request is retried after a network
+	// error, a 503 Service Unavailable or a 429 Too Many Requests response.
+	// Requests over the daily quota are not retried.
+	Retries int
+	// RetryWait is the wait before the first retry, which doubles with each
+	// retry.
+	RetryWait time.Duration
+}
+
+// Error is a response from the server with an unsuccessful status code. The
+// Code is one of the zilch error codes, such as zilch.ErrorCountryNotFound,
+// when the server sent a structured error.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// RetryAfter is how long the server asked the client to wait before
+	// trying again, from the Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("Zilch request failed: %v %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if len(e.Code) > 0 {
+		return fmt.Sprintf("Zilch request failed: %v %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("Zilch request failed: %v %s", e.StatusCode, e.Message)
+}
+
+// New creates a client for the server at the base URL, requesting JSON with
+// the default timeout and retries.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		Format:    "JSON",
+		Timeout:   defaultTimeout,
+		Retries:   defaultRetries,
+		RetryWait: defaultRetryWait,
+	}
+}
+
+func (c *Client) format() string {
+	if len(c.Format) == 0 {
+		return "JSON"
+	}
+	return strings.ToUpper(c.Format)
+}
+
+// Query finds the zip codes matching the query parameters, such as Country,
+// State, City, ZipCode and page.
+func (c *Client) Query(ctx context.Context, params map[string]string) (zilch.QueryResult, error) {
+	format := c.format()
+	data, err := c.get(ctx, "/query", format, params)
+	if err != nil {
+		return zilch.QueryResult{}, err
+	}
+	return zilch.UnmarshalQueryResult(format, data)
+}
+
+// QueryStream streams every zip code matching the query parameters to the
+// callback as it is read, without the paging limit of Query. The zip codes
+// are not sorted. The stream stops at the first error returned by the
+// callback. The Timeout only applies until the response starts, so that a
+// long stream is limited by the context instead.
+func (c *Client) QueryStream(ctx context.Context, params map[string]string, callback func(zilch.ZipEntry) error) error {
+	u := c.url("/query", "NDJSON", params)
+	var resp *http.Response
+	var cancel context.CancelFunc
+	err := c.retry(ctx, func() error {
+		attemptCtx, attemptCancel := context.WithCancel(ctx)
+		if c.Timeout > 0 {
+			timer := time.AfterFunc(c.Timeout, attemptCancel)
+			defer timer.Stop()
+		}
+		var err error
+		if resp, err = c.open(attemptCtx, "GET", u, nil); err != nil {
+			attemptCancel()
+			return err
+		}
+		// the successful attempt lasts until the stream is read
+		cancel = attemptCancel
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var entry zilch.ZipEntry
+		if err := dec.Decode(&entry); err != nil {
+			return err
+		}
+		if err := callback(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Distribution gets the number of zip codes in each cell of a grid covering
+// the zip codes matching the query parameters.
+func (c *Client) Distribution(ctx context.Context, params map[string]string) ([]zilch.DistributionEntry, error) {
+	format := c.format()
+	data, err := c.get(ctx, "/distribution", format, params)
+	if err != nil {
+		return nil, err
+	}
+	return zilch.UnmarshalDistributions(format, data)
+}
+
+// Countries gets the countries and their states.
+func (c *Client) Countries(ctx context.Context) ([]zilch.CountryEntry, error) {
+	format := c.format()
+	data, err := c.get(ctx, "/countries", format, nil)
+	if err != nil {
+		return nil, err
+	}
+	return zilch.UnmarshalCountryEntries(format, data)
+}
+
+// Suggest gets the typeahead suggestions for the query parameters, such as
+// Country and q.
+func (c *Client) Suggest(ctx context.Context, params map[string]string) ([]zilch.Suggestion, error) {
+	var s []zilch.Suggestion
+	err := c.getJSON(ctx, "/suggest", params, &s)
+	return s, err
+}
+
+// BatchLookup looks up many zip codes at once.
+func (c *Client) BatchLookup(ctx context.Context, lookups []zilch.BatchLookup) ([]zilch.BatchResult, error) {
+	body, err := json.Marshal(lookups)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.do(ctx, "POST", c.BaseURL+"/batch.json", body)
+	if err != nil {
+		return nil, err
+	}
+	var b []zilch.BatchResult
+	err = json.Unmarshal(data, &b)
+	return b, err
+}
+
+// Validate checks the consistency of the address in the query parameters,
+// such as Country, State, City and ZipCode.
+func (c *Client) Validate(ctx context.Context, params map[string]string) (zilch.AddressValidation, error) {
+	var v zilch.AddressValidation
+	err := c.getJSON(ctx, "/validate", params, &v)
+	return v, err
+}
+
+// ValidateFormat checks that the zip code is well formed for its country.
+func (c *Client) ValidateFormat(ctx context.Context, country, zipCode string) (zilch.FormatValidation, error) {
+	var v zilch.FormatValidation
+	err := c.getJSON(ctx, "/validate/format", map[string]string{"Country": country, "ZipCode": zipCode}, &v)
+	return v, err
+}
+
+// Normalize converts the zip code into the canonical form for its country.
+func (c *Client) Normalize(ctx context.Context, country, zipCode string) (zilch.NormalizedPostalCode, error) {
+	var n zilch.NormalizedPostalCode
+	err := c.getJSON(ctx, "/normalize", map[string]string{"Country": country, "ZipCode": zipCode}, &n)
+	return n, err
+}
+
+// Country gets a country and its states.
+func (c *Client) Country(ctx context.Context, country string) (zilch.Region, error) {
+	return c.getRegion(ctx, "/countries/"+url.PathEscape(country))
+}
+
+// State gets a state of a country.
+func (c *Client) State(ctx context.Context, country, state string) (zilch.Region, error) {
+	return c.getRegion(ctx, "/countries/"+url.PathEscape(country)+"/states/"+url.PathEscape(state))
+}
+
+// Counties gets the counties in a state.
+func (c *Client) Counties(ctx context.Context, country, state string) (zilch.Region, error) {
+	return c.getRegion(ctx, "/countries/"+url.PathEscape(country)+"/states/"+url.PathEscape(state)+"/counties")
+}
+
+// Cities gets the cities in a state.
+func (c *Client) Cities(ctx context.Context, country, state string) (zilch.Region, error) {
+	return c.getRegion(ctx, "/countries/"+url.PathEscape(country)+"/states/"+url.PathEscape(state)+"/cities")
+}
+
+// ZipCode gets a single zip code.
+func (c *Client) ZipCode(ctx context.Context, country, zipCode string) (zilch.Region, error) {
+	return c.getRegion(ctx, "/zip/"+url.PathEscape(country)+"/"+url.PathEscape(zipCode))
+}
+
+func (c *Client) getRegion(ctx context.Context, path string) (zilch.Region, error) {
+	var r zilch.Region
+	err := c.getJSON(ctx, path, nil, &r)
+	return r, err
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, params map[string]string, v interface{}) error {
+	data, err := c.get(ctx, path, "JSON", params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *Client) get(ctx context.Context, path, format string, params map[string]string) ([]byte, error) {
+	return c.do(ctx, "GET", c.url(path, format, params), nil)
+}
+
+func (c *Client) url(path, format string, params map[string]string) string {
+	u := c.BaseURL + path + "." + strings.ToLower(format)
+	if len(params) > 0 {
+		values := url.Values{}
+		for key, value := range params {
+			values.Set(key, value)
+		}
+		u += "?" + values.Encode()
+	}
+	return u
+}
+
+// do sends the request and reads the response, retrying after network
+// errors and 503 and 429 responses.
+func (c *Client) do(ctx context.Context, method, u string, body []byte) ([]byte, error) {
+	var data []byte
+	err := c.retry(ctx, func() error {
+		var err error
+		data, err = c.send(ctx, method, u, body)
+		return err
+	})
+	return data, err
+}
+
+// retry calls the attempt until it succeeds or fails with an error which is
+// not retryable, the retries run out or the context is done. It waits for at
+// least as long as the server asks in a Retry-After header.
+func (c *Client) retry(ctx context.Context, attempt func() error) error {
+	wait := c.RetryWait
+	for retries := 0; ; retries++ {
+		err := attempt()
+		if err == nil || ctx.Err() != nil || retries >= c.Retries || !isRetryable(err) {
+			return err
+		}
+
+		delay := wait
+		var e *Error
+		if errors.As(err, &e) && e.RetryAfter > delay {
+			delay = e.RetryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, u string, body []byte) ([]byte, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	resp, err := c.open(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// open sends the request and returns the successful response, which must be
+// closed by the caller.
+func (c *Client) open(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.APIKey) > 0 {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		e := responseError(resp, data)
+		e.RetryAfter = retryAfter(resp.Header.Get("Retry-After"))
+		return nil, e
+	}
+	return resp, nil
+}
+
+// retryAfter reads a Retry-After header, which is either a number of seconds
+// or an HTTP date. It is zero when the header is missing or in the past.
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// errorFormats maps the media types of the structured error responses to
+// their formats.
+var errorFormats = map[string]string{
+	"application/json":    "JSON",
+	"text/xml":            "XML",
+	"text/yaml":           "YAML",
+	"application/msgpack": "MSGPACK",
+}
+
+// responseError reads the structured error in the body of the response, or
+// uses the body as the message when it is not structured.
+func responseError(resp *http.Response, data []byte) *Error {
+	mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	if format, found := errorFormats[mediaType]; found {
+		if e, err := zilch.UnmarshalError(format, data); err == nil && len(e.Code) > 0 {
+			return &Error{StatusCode: resp.StatusCode, Code: e.Code, Message: e.Message}
+		}
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+}
+
+// isRetryable determines whether a request may succeed when it is sent
+// again, which is after a network error or a connection closed in the middle
+// of the response, while the server is unavailable, or when the client has
+// sent too many requests but is still within its quota. Malformed URLs,
+// unsupported schemes and certificate failures are not retried, and neither
+// are errors reading the body of a response.
+func isRetryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		switch e.StatusCode {
+		case http.StatusServiceUnavailable:
+			return true
+		case http.StatusTooManyRequests:
+			return e.Code != zilch.ErrorQuotaExceeded
+		}
+		return false
+	}
+
+	// every error of the http client is a *url.Error, which is a net.Error
+	// itself, so only the error it wraps tells whether the network failed
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	err = urlErr.Err
+	if isTLSError(err) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isTLSError determines whether the error is a failed TLS handshake or
+// certificate check, which fails the same way each time.
+func isTLSError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	return errors.As(err, &recordErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &hostnameErr)
+}
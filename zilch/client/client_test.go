@@ -0,0 +1,418 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rchargel/zilch/zilch"
+)
+
+var testQueryResult = zilch.QueryResult{
+	ResultsReturned: 1,
+	TotalFound:      1,
+	StartIndex:      1,
+	EndIndex:        1,
+	ZipCodeEntries: []zilch.ZipEntry{
+		zilch.ZipEntry{
+			ZipCode:            "102-0072",
+			Type:               "STANDARD",
+			City:               "Chiyoda",
+			AcceptableCities:   []string{},
+			UnacceptableCities: []string{},
+			State:              "13",
+			StateName:          "Tokyo",
+			Country:            "JP",
+			CountryName:        "Japan",
+			TimeZone:           "Asia/Tokyo",
+			AreaCodes:          []string{},
+			Latitude:           35.69,
+			Longitude:          139.75,
+		},
+	},
+}
+
+var testCountries = []zilch.CountryEntry{
+	zilch.CountryEntry{
+		Country:     "JP",
+		CountryName: "Japan",
+		ZipCodes:    1,
+		Latitude:    35.69,
+		Longitude:   139.75,
+		Bounds:      zilch.BoundingBox{North: 35.69, West: 139.75, South: 35.69, East: 139.75},
+		Coverage:    1,
+		States:      []zilch.StateEntry{zilch.StateEntry{State: "13", StateName: "Tokyo", ZipCodes: 1, Latitude: 35.69, Longitude: 139.75, Bounds: zilch.BoundingBox{North: 35.69, West: 139.75, South: 35.69, East: 139.75}, Coverage: 1}},
+	},
+}
+
+var testDistributions = []zilch.DistributionEntry{
+	zilch.DistributionEntry{Latitude: 35, Longitude: 139, ZipCodes: 1},
+}
+
+// testHandler serves the test data in the format of the path extension.
+func testHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ext := path.Ext(r.URL.Path)
+		format := strings.TrimPrefix(ext, ".")
+		var response string
+		var err error
+		switch strings.TrimSuffix(r.URL.Path, ext) {
+		case "/query":
+			if r.FormValue("Country") != "JP" {
+				http.Error(w, "No country "+r.FormValue("Country")+" found", 500)
+				return
+			}
+			response, err = testQueryResult.Marshal(format)
+		case "/countries":
+			response, err = zilch.CountryEntryMarshaller(testCountries).Marshal(format)
+		case "/distribution":
+			response, err = zilch.DistributionMarshaller(testDistributions).Marshal(format)
+		case "/normalize":
+			response, err = zilch.NormalizedPostalCode{ZipCode: r.FormValue("ZipCode"), Country: r.FormValue("Country"), Normalized: "102-0072"}.Marshal(format)
+		case "/batch":
+			var lookups []zilch.BatchLookup
+			if err := json.NewDecoder(r.Body).Decode(&lookups); err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			results := make([]zilch.BatchResult, len(lookups))
+			for i, lookup := range lookups {
+				results[i] = zilch.BatchResult{Country: lookup.Country, ZipCode: lookup.ZipCode, Found: true, ZipCodeEntries: testQueryResult.ZipCodeEntries}
+			}
+			response, err = zilch.BatchResultMarshaller(results).Marshal(format)
+		case "/zip/JP/102-0072":
+			response, err = zilch.Region{Type: "ZipCode", Code: "102-0072", Name: "102-0072", ZipCodes: 1}.Marshal(format)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Write([]byte(response))
+	}
+}
+
+func Test_Client_Query(t *testing.T) {
+	server := httptest.NewServer(testHandler(t))
+	defer server.Close()
+
+	c := New(server.URL)
+	for _, format := range []string{"JSON", "XML", "YAML", "MSGPACK", "GEOJSON", "CSV", "TSV"} {
+		c.Format = format
+		q, err := c.Query(context.Background(), map[string]string{"Country": "JP"})
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+		} else if q.ResultsReturned != 1 || q.ZipCodeEntries[0].City != "Chiyoda" || q.ZipCodeEntries[0].Latitude != 35.69 {
+			t.Errorf("Wrong %s query result: %v", format, q)
+		}
+	}
+	for _, format := range []string{"KML", "GPX"} {
+		c.Format = format
+		q, err := c.Query(context.Background(), map[string]string{"Country": "JP"})
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+		} else if q.ResultsReturned != 1 || q.ZipCodeEntries[0].ZipCode != "102-0072" || q.ZipCodeEntries[0].Longitude != 139.75 {
+			t.Errorf("Wrong %s query result: %v", format, q)
+		}
+	}
+}
+
+func Test_Client_Countries_And_Distribution(t *testing.T) {
+	server := httptest.NewServer(testHandler(t))
+	defer server.Close()
+
+	c := New(server.URL)
+	for _, format := range []string{"JSON", "XML", "YAML", "MSGPACK", "GEOJSON"} {
+		c.Format = format
+		countries, err := c.Countries(context.Background())
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+		} else if len(countries) != 1 || countries[0].Country != "JP" || countries[0].States[0].StateName != "Tokyo" {
+			t.Errorf("Wrong %s countries: %v", format, countries)
+		}
+
+		distributions, err := c.Distribution(context.Background(), map[string]string{"Country": "JP"})
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+		} else if len(distributions) != 1 || distributions[0] != testDistributions[0] {
+			t.Errorf("Wrong %s distribution: %v", format, distributions)
+		}
+	}
+}
+
+func Test_Client_JSON_Endpoints(t *testing.T) {
+	server := httptest.NewServer(testHandler(t))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Format = "XML"
+	ctx := context.Background()
+
+	if n, err := c.Normalize(ctx, "JP", "1020072"); err != nil {
+		t.Error(err)
+	} else if n.Normalized != "102-0072" || n.ZipCode != "1020072" {
+		t.Errorf("Wrong normalized code: %v", n)
+	}
+
+	if b, err := c.BatchLookup(ctx, []zilch.BatchLookup{zilch.BatchLookup{Country: "JP", ZipCode: "102-0072"}}); err != nil {
+		t.Error(err)
+	} else if len(b) != 1 || !b[0].Found || b[0].ZipCodeEntries[0].City != "Chiyoda" {
+		t.Errorf("Wrong batch results: %v", b)
+	}
+
+	if r, err := c.ZipCode(ctx, "JP", "102-0072"); err != nil {
+		t.Error(err)
+	} else if r.Type != "ZipCode" || r.Code != "102-0072" {
+		t.Errorf("Wrong region: %v", r)
+	}
+}
+
+func Test_Client_Error(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "No country US found", 500)
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	_, err := c.Query(context.Background(), map[string]string{"Country": "US"})
+	if e, ok := err.(*Error); !ok || e.StatusCode != 500 || e.Message != "No country US found" {
+		t.Errorf("Wrong error: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected a single request, found %v", requests)
+	}
+}
+
+func Test_Client_Structured_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, _ := zilch.Error{Status: 404, Code: zilch.ErrorCountryNotFound, Message: "No country XX found"}.Marshal("XML")
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).Country(context.Background(), "XX")
+	if e, ok := err.(*Error); !ok || e.StatusCode != 404 || e.Code != zilch.ErrorCountryNotFound || e.Message != "No country XX found" {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func Test_Client_Retry(t *testing.T) {
+	var requests int32
+	handler := testHandler(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			http.Error(w, "Loading", 503)
+			return
+		}
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.RetryWait = time.Millisecond
+	if q, err := c.Query(context.Background(), map[string]string{"Country": "JP"}); err != nil {
+		t.Error(err)
+	} else if q.ResultsReturned != 1 || requests != 3 {
+		t.Errorf("Wrong result after %v requests: %v", requests, q)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	c.Retries = 1
+	_, err := c.Query(context.Background(), map[string]string{"Country": "JP"})
+	if e, ok := err.(*Error); !ok || e.StatusCode != 503 || requests != 2 {
+		t.Errorf("Wrong error after %v requests: %v", requests, err)
+	}
+}
+
+func Test_Client_Retry_Statuses(t *testing.T) {
+	var requests int32
+	status, code := 0, ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		response, _ := zilch.Error{Status: status, Code: code, Message: "Too many"}.Marshal("JSON")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Retries = 1
+	c.RetryWait = time.Millisecond
+	tests := []struct {
+		status   int
+		code     string
+		requests int32
+	}{
+		{429, zilch.ErrorRateLimited, 2},
+		{429, zilch.ErrorQuotaExceeded, 1},
+		{502, zilch.ErrorInternal, 1},
+		{500, zilch.ErrorInternal, 1},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&requests, 0)
+		status, code = test.status, test.code
+		start := time.Now()
+		_, err := c.Countries(context.Background())
+		if e, ok := err.(*Error); !ok || e.StatusCode != test.status || e.RetryAfter != time.Second || requests != test.requests {
+			t.Errorf("Wrong error for %v %v after %v requests: %v", test.status, test.code, requests, err)
+		}
+		// the retry waits for the Retry-After header
+		if test.requests > 1 && time.Since(start) < time.Second {
+			t.Errorf("Expected a wait of a second before retrying, waited %v", time.Since(start))
+		}
+	}
+}
+
+// countingTransport counts the requests sent through the default transport.
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func Test_Client_No_Retry_Of_Request_Errors(t *testing.T) {
+	transport := &countingTransport{}
+	c := New("ftp://localhost")
+	c.HTTPClient = &http.Client{Transport: transport}
+	c.RetryWait = time.Millisecond
+	if _, err := c.Countries(context.Background()); err == nil || !strings.Contains(err.Error(), "unsupported protocol scheme") {
+		t.Errorf("Wrong error for a bad scheme: %v", err)
+	}
+	if transport.requests != 1 {
+		t.Errorf("Expected a single attempt with a bad scheme, found %v", transport.requests)
+	}
+
+	// the certificate of a test server is not trusted
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	transport = &countingTransport{}
+	c = New(server.URL)
+	c.HTTPClient = &http.Client{Transport: transport}
+	c.RetryWait = time.Millisecond
+	if _, err := c.Countries(context.Background()); err == nil {
+		t.Error("Expected an error for an untrusted certificate")
+	}
+	if transport.requests != 1 {
+		t.Errorf("Expected a single attempt with an untrusted certificate, found %v", transport.requests)
+	}
+}
+
+func Test_RetryAfter(t *testing.T) {
+	if wait := retryAfter("3"); wait != 3*time.Second {
+		t.Errorf("Wrong wait for seconds %v", wait)
+	}
+	if wait := retryAfter(time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)); wait <= 8*time.Second || wait > 10*time.Second {
+		t.Errorf("Wrong wait for a date %v", wait)
+	}
+	for _, value := range []string{"", "0", "-1", "soon", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)} {
+		if wait := retryAfter(value); wait != 0 {
+			t.Errorf("Wrong wait for %q: %v", value, wait)
+		}
+	}
+}
+
+func Test_Client_Timeout(t *testing.T) {
+	var requests int32
+	done := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	c := New(server.URL)
+	c.Timeout = 20 * time.Millisecond
+	c.Retries = 1
+	c.RetryWait = time.Millisecond
+	if _, err := c.Countries(context.Background()); err == nil {
+		t.Error("Expected a timeout")
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("Expected the timed out request to be retried, found %v requests", requests)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Countries(ctx); err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("Wrong error for a canceled context: %v", err)
+	}
+}
+
+func Test_Client_QueryStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/query.ndjson" || r.URL.Query().Get("Country") != "JP" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		enc := json.NewEncoder(w)
+		for i := 0; i < 3; i++ {
+			enc.Encode(testQueryResult.ZipCodeEntries[0])
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	entries := make([]zilch.ZipEntry, 0)
+	err := c.QueryStream(context.Background(), map[string]string{"Country": "JP"}, func(entry zilch.ZipEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil || len(entries) != 3 || entries[2].City != "Chiyoda" {
+		t.Errorf("Wrong stream %v: %v", err, entries)
+	}
+
+	calls := 0
+	err = c.QueryStream(context.Background(), map[string]string{"Country": "JP"}, func(entry zilch.ZipEntry) error {
+		calls++
+		return context.Canceled
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Errorf("Expected the stream to stop after %v calls: %v", calls, err)
+	}
+
+	err = c.QueryStream(context.Background(), map[string]string{"Country": "XX"}, func(entry zilch.ZipEntry) error { return nil })
+	if e, ok := err.(*Error); !ok || e.StatusCode != 404 {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func Test_Client_APIKey(t *testing.T) {
+	limiter := zilch.NewRateLimiter(zilch.RateLimitConfig{Keys: []zilch.APIKey{{Key: "secret", Name: "Test"}}})
+	server := httptest.NewServer(limiter.Handler(testHandler(t)))
+	defer server.Close()
+
+	c := New(server.URL)
+	if _, err := c.Countries(context.Background()); err == nil || err.(*Error).Code != zilch.ErrorAPIKeyRequired {
+		t.Errorf("Wrong error without a key: %v", err)
+	}
+	c.APIKey = "secret"
+	if _, err := c.Countries(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,11 +1,16 @@
 package zilch
 
 // DistributionEntry is used to track the number of
-// zip codes located in a latitude/longitude block.
+// zip codes located in a latitude/longitude block. For square grids the
+// latitude and longitude are the south west corner of the block, and for
+// hexagonal grids they are the center. The Resolution and Grid are left
+// empty for the default 1 degree square grid.
 type DistributionEntry struct {
-	Latitude  int16
-	Longitude int16
-	ZipCodes  uint32
+	Latitude   float32
+	Longitude  float32
+	ZipCodes   uint32
+	Resolution float32 `json:",omitempty" xml:",omitempty"`
+	Grid       string  `json:",omitempty" xml:",omitempty"`
 }
 
 // DistributionMarshaller is used to marshal
@@ -37,38 +42,81 @@ type ZipEntry struct {
 	AreaCodes          []string
 	Latitude           float32
 	Longitude          float32
+	LocalTime          *LocalTimeInfo `json:",omitempty"`
+}
+
+// BoundingBox is the smallest latitude/longitude block containing a set
+// of zip codes.
+type BoundingBox struct {
+	North float32
+	West  float32
+	South float32
+	East  float32
 }
 
 // StateEntry is an object which maps the state information, to the
-// number of zip codes in that state.
+// number of zip codes in that state. The Latitude and Longitude are the
+// centroid of the zip codes with coordinates, and the Coverage is the share
+// of zip codes which have coordinates.
 type StateEntry struct {
 	State     string
 	StateName string
 	ZipCodes  uint32
+	Latitude  float32
+	Longitude float32
+	Bounds    BoundingBox
+	Coverage  float32
 }
 
 // CountryEntry is an object which maps a country to a set of states/provinces.
 type CountryEntry struct {
 	Country     string
 	CountryName string
+	ZipCodes    uint32
+	Latitude    float32
+	Longitude   float32
+	Bounds      BoundingBox
+	Coverage    float32
 	States      []StateEntry
 }
 
 // CountryEntryMarshaller is used to marshal a CountryEntry.
 type CountryEntryMarshaller []CountryEntry
 
+// FacetValue is the number of matching zip codes sharing a single value
+// of a faceted field.
+type FacetValue struct {
+	Value string
+	Count int
+}
+
+// Facet holds the counts of matching zip codes grouped by the values of
+// a single field.
+type Facet struct {
+	Field  string
+	Values []FacetValue
+}
+
 // QueryResult holds the result of a zip code query.
 type QueryResult struct {
 	ResultsReturned int
 	TotalFound      int
 	StartIndex      int
 	EndIndex        int
+	Facets          []Facet `json:",omitempty"`
 	ZipCodeEntries  []ZipEntry
+
+	// groupBy groups the zip codes of the KML and GPX formats by State or
+	// County, as set by MarshalGrouped.
+	groupBy string
 }
 
 // ZipSorter sorts the ZipEntry slice.
 type ZipSorter []ZipEntry
 
+// FacetValueSorter sorts the FacetValue slice, largest count first.
+type FacetValueSorter []FacetValue
+
 // StateSorter sorts the StateEntry slice.
 type StateSorter []StateEntry
 
@@ -80,6 +128,30 @@ func (z ZipEntry) GetKey() uint32 {
 	return getKeyFromLatitudeLongitude(z.Latitude, z.Longitude)
 }
 
+// hasCoordinates determines whether the zip code has a location. Zip codes
+// without one are at 0,0, and are left out of the distributions.
+func (z ZipEntry) hasCoordinates() bool {
+	return z.Latitude != 0 || z.Longitude != 0
+}
+
+func (z ZipEntry) facetValue(field string) string {
+	switch field {
+	case "Country":
+		return z.Country
+	case "State":
+		return z.State
+	case "County":
+		return z.County
+	case "City":
+		return z.City
+	case "Type":
+		return z.Type
+	case "TimeZone":
+		return z.TimeZone
+	}
+	return ""
+}
+
 func (z ZipSorter) Len() int      { return len(z) }
 func (z ZipSorter) Swap(i, j int) { z[i], z[j] = z[j], z[i] }
 func (z ZipSorter) Less(i, j int) bool {
@@ -93,6 +165,15 @@ func (d DistributionSorter) Len() int           { return len(d) }
 func (d DistributionSorter) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
 func (d DistributionSorter) Less(i, j int) bool { return d[i].ZipCodes < d[j].ZipCodes }
 
+func (f FacetValueSorter) Len() int      { return len(f) }
+func (f FacetValueSorter) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f FacetValueSorter) Less(i, j int) bool {
+	if f[i].Count != f[j].Count {
+		return f[i].Count > f[j].Count
+	}
+	return f[i].Value < f[j].Value
+}
+
 func (s StateSorter) Len() int           { return len(s) }
 func (s StateSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s StateSorter) Less(i, j int) bool { return s[i].State < s[j].State }
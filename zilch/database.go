@@ -1,9 +1,11 @@
 package zilch
 
 import (
-	"errors"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
+	"net/url"
+	"os"
 	"regexp"
 	"sort"
 	"strconv"
@@ -15,10 +17,23 @@ const (
 	maxEntries int = 200
 )
 
+// QueryFilters is the list of query parameters which restrict the zip codes
+// matched by a query.
+var QueryFilters = []string{"Country", "ZipCode", "City", "ExactCity", "AreaCode", "ExactAreaCode", "State", "County", "ExactCounty", "TimeZone", "Type", "Bounds"}
+
+// FacetFields is the list of ZipEntry fields which may be requested
+// as facets of a query.
+var FacetFields = []string{"Country", "State", "County", "City", "Type", "TimeZone"}
+
+// ZipTypes is the list of valid values for the Type of a ZipEntry.
+var ZipTypes = []string{"STANDARD", "PO BOX", "UNIQUE", "MILITARY"}
+
 // CountryIndex tracks the country to the list of ZipEntry objects.
 type CountryIndex struct {
 	CountryCode string
 	Entries     []ZipEntry
+	zipIndex    map[string][]int
+	regions     *countryRegion
 }
 
 // Database is a representation of the actual database of zip codes.
@@ -27,6 +42,15 @@ type Database struct {
 	DistributionMap map[uint32]DistributionEntry
 	CountryList     []CountryEntry
 	FullyLoaded     bool
+	// Version identifies the files the database was read from, and changes
+	// whenever one of them does. It is computed once, as the files are only
+	// read when the server starts.
+	Version string
+	// Modified is when the newest of the files was last changed.
+	Modified time.Time
+
+	queryCache *LRUCache
+	imageCache *LRUCache
 }
 
 // NewDatabase creates a database from the file directory.
@@ -37,6 +61,8 @@ func NewDatabase(filedir string) (*Database, error) {
 		DistributionMap: make(map[uint32]DistributionEntry),
 		CountryList:     make([]CountryEntry, 0, 0),
 		FullyLoaded:     false,
+		queryCache:      NewLRUCache("queries", QueryCacheSize),
+		imageCache:      NewLRUCache("images", ImageCacheSize),
 	}
 
 	channelMap := make(map[string]chan ZipEntry)
@@ -47,6 +73,8 @@ func NewDatabase(filedir string) (*Database, error) {
 		return d, err
 	}
 
+	d.Version, d.Modified = datasetVersion(files)
+
 	distributionChannel := make(chan map[uint32]int)
 	channels := 0
 
@@ -70,74 +98,41 @@ func NewDatabase(filedir string) (*Database, error) {
 	return d, nil
 }
 
+// datasetVersion gets a version from the names, sizes and modification times
+// of the database files, and the newest modification time.
+func datasetVersion(files []os.FileInfo) (string, time.Time) {
+	hash := fnv.New64a()
+	var modified time.Time
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s:%d:%d\n", file.Name(), file.Size(), file.ModTime().UnixNano())
+		if file.ModTime().After(modified) {
+			modified = file.ModTime()
+		}
+	}
+	return strconv.FormatUint(hash.Sum64(), 36), modified
+}
+
 func (d *Database) loadCountryData(countryCode string, channel chan ZipEntry, distChannel chan map[uint32]int) {
 	entries := make([]ZipEntry, 0, 1000)
 	distMap := make(map[uint32]int)
-
-	type stateData struct {
-		State     string
-		StateName string
-		ZipCodes  int
-	}
-	type countryData struct {
-		Country     string
-		CountryName string
-		States      map[string]stateData
-	}
-
-	country := countryData{
-		Country:     countryCode,
-		CountryName: "",
-		States:      make(map[string]stateData),
-	}
+	regions := newCountryRegion(countryCode)
 
 	for entry := range channel {
 		entries = append(entries, entry)
-		distMap[entry.GetKey()]++
-
-		if len(country.CountryName) == 0 {
-			country.CountryName = entry.CountryName
-		}
-
-		if len(entry.State) > 0 {
-			if state, found := country.States[entry.State]; found {
-				country.States[entry.State] = stateData{
-					State:     state.State,
-					StateName: state.StateName,
-					ZipCodes:  state.ZipCodes + 1,
-				}
-			} else {
-				country.States[entry.State] = stateData{
-					State:     entry.State,
-					StateName: entry.StateName,
-					ZipCodes:  1,
-				}
-			}
+		if entry.hasCoordinates() {
+			distMap[entry.GetKey()]++
 		}
+		regions.add(entry)
 	}
 
-	countryEntry := CountryEntry{
-		Country:     country.Country,
-		CountryName: country.CountryName,
-		States:      make([]StateEntry, len(country.States)),
-	}
-	var idx int
-	for _, st := range country.States {
-		countryEntry.States[idx] = StateEntry{
-			State:     st.State,
-			StateName: st.StateName,
-			ZipCodes:  uint32(st.ZipCodes),
-		}
-		idx++
-	}
-
-	sort.Sort(StateSorter(countryEntry.States))
-
-	d.CountryIndexMap[countryCode] = CountryIndex{
+	countryIndex := CountryIndex{
 		CountryCode: countryCode,
 		Entries:     entries,
+		regions:     regions,
 	}
-	d.CountryList = append(d.CountryList, countryEntry)
+	countryIndex.buildZipIndex()
+	d.CountryIndexMap[countryCode] = countryIndex
+	d.CountryList = append(d.CountryList, regions.countryEntry())
 
 	distChannel <- distMap
 }
@@ -155,23 +150,20 @@ func (d *Database) finishDistributionChannels(distChannel chan map[uint32]int, t
 		channels++
 
 		for key, total := range distMap {
-			// key == 180090 = where equater meets prime meridian, not a real place
-			if key != 180090 {
-				lat, lon := getLatitudeLongitudeFromKey(key)
-				if _, found := d.DistributionMap[key]; !found {
-					d.DistributionMap[key] = DistributionEntry{
-						Latitude:  lat,
-						Longitude: lon,
-						ZipCodes:  uint32(total),
-					}
-				} else {
-					zipCodes := d.DistributionMap[key].ZipCodes + uint32(total)
+			lat, lon := getLatitudeLongitudeFromKey(key)
+			if _, found := d.DistributionMap[key]; !found {
+				d.DistributionMap[key] = DistributionEntry{
+					Latitude:  float32(lat),
+					Longitude: float32(lon),
+					ZipCodes:  uint32(total),
+				}
+			} else {
+				zipCodes := d.DistributionMap[key].ZipCodes + uint32(total)
 
-					d.DistributionMap[key] = DistributionEntry{
-						Latitude:  lat,
-						Longitude: lon,
-						ZipCodes:  uint32(zipCodes),
-					}
+				d.DistributionMap[key] = DistributionEntry{
+					Latitude:  float32(lat),
+					Longitude: float32(lon),
+					ZipCodes:  uint32(zipCodes),
 				}
 			}
 		}
@@ -203,22 +195,65 @@ func (d *Database) GetDistributions() []DistributionEntry {
 	return entries
 }
 
-// ExecQuery executes a query against the database.
+// ExecQuery executes a query against the database. The results are cached,
+// apart from the local times which are added to each result.
 func (d *Database) ExecQuery(queryParams map[string]string) (QueryResult, error) {
 	if len(queryParams) == 0 {
-		return QueryResult{}, errors.New("There are no query parameters")
+		return QueryResult{}, badRequestError(ErrorMissingParameter, "There are no query parameters")
 	}
-	var entries []ZipEntry
-	var err error
-	if country, found := queryParams["Country"]; found {
-		entries, err = d.querySingleCountry(country, queryParams)
+
+	var result QueryResult
+	key := queryCacheKey(queryParams)
+	if cached, found := d.queryCache.Get(d.Version, key); found {
+		result = cached.(QueryResult)
 	} else {
-		entries, err = d.queryAllCountries(queryParams)
+		var err error
+		if result, err = d.execQuery(queryParams); err != nil {
+			return QueryResult{}, err
+		}
+		if d.IsFullyLoaded() {
+			d.queryCache.Add(d.Version, key, result, result.cacheSize())
+		}
+	}
+
+	if localTime, found := queryParams["localtime"]; found && localTime == "true" {
+		// the cached entries are shared, so the local times go on a copy
+		entries := make([]ZipEntry, len(result.ZipCodeEntries))
+		copy(entries, result.ZipCodeEntries)
+		now := time.Now()
+		for i := range entries {
+			entries[i].LocalTime = GetLocalTime(entries[i].TimeZone, now)
+		}
+		result.ZipCodeEntries = entries
 	}
+	return result, nil
+}
+
+// queryCacheKey gets the cache key of a query from the parameters which
+// change its result, in order of name.
+func queryCacheKey(queryParams map[string]string) string {
+	values := url.Values{}
+	for _, param := range append([]string{"facets", "page"}, QueryFilters...) {
+		if value, found := queryParams[param]; found {
+			values.Set(param, value)
+		}
+	}
+	return values.Encode()
+}
+
+func (d *Database) execQuery(queryParams map[string]string) (QueryResult, error) {
+	entries, err := d.findEntries(queryParams)
 	if err != nil {
 		return QueryResult{}, err
 	}
 
+	var facets []Facet
+	if facetParam, found := queryParams["facets"]; found {
+		if facets, err = buildFacets(facetParam, entries); err != nil {
+			return QueryResult{}, err
+		}
+	}
+
 	total := len(entries)
 	start := 0
 	end := len(entries)
@@ -228,8 +263,8 @@ func (d *Database) ExecQuery(queryParams map[string]string) (QueryResult, error)
 		end = maxEntries
 		if page, pageFound := queryParams["page"]; pageFound {
 			p, perr := strconv.ParseUint(page, 10, 32)
-			if perr != nil {
-				return QueryResult{}, perr
+			if perr != nil || p == 0 {
+				return QueryResult{}, badRequestError(ErrorInvalidParameter, "Invalid page: %s", page)
 			}
 			start = (int(p) - 1) * maxEntries
 			end = start + maxEntries
@@ -240,17 +275,94 @@ func (d *Database) ExecQuery(queryParams map[string]string) (QueryResult, error)
 				end = total
 			}
 		}
-		entries = entries[start:end]
+		// copy the page, so that a cached result does not hold every match
+		entries = append([]ZipEntry(nil), entries[start:end]...)
 	}
 	return QueryResult{
 		ResultsReturned: len(entries),
 		TotalFound:      total,
 		StartIndex:      start + 1,
 		EndIndex:        end,
+		Facets:          facets,
 		ZipCodeEntries:  entries,
 	}, nil
 }
 
+// HasQueryFilters determines whether any of the QueryFilters are in the
+// query parameters.
+func HasQueryFilters(queryParams map[string]string) bool {
+	for _, filter := range QueryFilters {
+		if _, found := queryParams[filter]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// findEntries finds all of the entries matching the query filters, in no
+// particular order.
+func (d *Database) findEntries(queryParams map[string]string) ([]ZipEntry, error) {
+	if err := validateQueryFilters(queryParams); err != nil {
+		return nil, err
+	}
+	if country, found := queryParams["Country"]; found {
+		return d.querySingleCountry(country, queryParams)
+	}
+	return d.queryAllCountries(queryParams)
+}
+
+// validateQueryFilters checks the query filters which can be wrong, rather
+// than just not matching anything.
+func validateQueryFilters(queryParams map[string]string) error {
+	if zipType, found := queryParams["Type"]; found && !isValidZipType(zipType) {
+		return badRequestError(ErrorInvalidParameter, "Invalid type: %s", zipType)
+	}
+	if zipCode, found := queryParams["ZipCode"]; found {
+		if format, formatFound := PostalCodeFormats[queryParams["Country"]]; formatFound && !format.AcceptsPrefix(zipCode) {
+			return badRequestError(ErrorInvalidParameter, "Invalid zip code %s for country %s", zipCode, format.Country)
+		}
+	}
+	return nil
+}
+
+func buildFacets(facetParam string, entries []ZipEntry) ([]Facet, error) {
+	fields := make([]string, 0, len(FacetFields))
+	for _, field := range strings.Split(facetParam, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		valid := false
+		for _, facetField := range FacetFields {
+			if strings.EqualFold(field, facetField) {
+				fields = append(fields, facetField)
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, badRequestError(ErrorInvalidParameter, "Invalid facet: %s", field)
+		}
+	}
+
+	facets := make([]Facet, len(fields))
+	for i, field := range fields {
+		counts := make(map[string]int)
+		for _, entry := range entries {
+			if value := entry.facetValue(field); len(value) > 0 {
+				counts[value]++
+			}
+		}
+		values := make([]FacetValue, 0, len(counts))
+		for value, count := range counts {
+			values = append(values, FacetValue{Value: value, Count: count})
+		}
+		sort.Sort(FacetValueSorter(values))
+		facets[i] = Facet{Field: field, Values: values}
+	}
+	return facets, nil
+}
+
 func (d *Database) querySingleCountry(country string, queryParams map[string]string) ([]ZipEntry, error) {
 	entries := make([]ZipEntry, 0, 20)
 	if countryIndex, found := d.CountryIndexMap[country]; found {
@@ -261,7 +373,7 @@ func (d *Database) querySingleCountry(country string, queryParams map[string]str
 		}
 		return entries, nil
 	}
-	return entries, fmt.Errorf("No country %s found", country)
+	return entries, notFoundError(ErrorCountryNotFound, "No country %s found", country)
 }
 
 func (d *Database) queryAllCountries(queryParams map[string]string) ([]ZipEntry, error) {
@@ -326,6 +438,14 @@ func (c CountryIndex) QueryIndex(queryParams map[string]string, ch chan ZipEntry
 		}
 		return false
 	}
+	equalsInArray := func(expected string, actual []string) bool {
+		for _, val := range actual {
+			if strings.ToLower(val) == expected {
+				return true
+			}
+		}
+		return false
+	}
 	inBounds := func(bounds []float32, latitude, longitude float32) bool {
 		if latitude == 0 && longitude == 0 {
 			return false
@@ -341,9 +461,14 @@ func (c CountryIndex) QueryIndex(queryParams map[string]string, ch chan ZipEntry
 	bounds, boundsTest := boundsData(queryParams)
 	zipCode, zipCodeTest := stringData("ZipCode", queryParams)
 	city, cityTest := stringData("City", queryParams)
+	exactCity, exactCityTest := stringData("ExactCity", queryParams)
 	areaCode, areaCodeTest := stringData("AreaCode", queryParams)
+	exactAreaCode, exactAreaCodeTest := stringData("ExactAreaCode", queryParams)
 	state, stateTest := stringData("State", queryParams)
 	county, countyTest := stringData("County", queryParams)
+	exactCounty, exactCountyTest := stringData("ExactCounty", queryParams)
+	timeZone, timeZoneTest := stringData("TimeZone", queryParams)
+	zipType, zipTypeTest := stringData("Type", queryParams)
 
 	for _, entry := range c.Entries {
 		if zipCodeTest {
@@ -365,11 +490,21 @@ func (c CountryIndex) QueryIndex(queryParams map[string]string, ch chan ZipEntry
 				}
 			}
 		}
+		if exactCityTest {
+			if exactCity != strings.ToLower(entry.City) {
+				continue
+			}
+		}
 		if areaCodeTest {
 			if !inArray(areaCode, entry.AreaCodes) {
 				continue
 			}
 		}
+		if exactAreaCodeTest {
+			if !equalsInArray(exactAreaCode, entry.AreaCodes) {
+				continue
+			}
+		}
 		if stateTest {
 			if state != strings.ToLower(entry.State) {
 				if len(state) == 2 || !contains(state, strings.ToLower(entry.StateName)) {
@@ -378,7 +513,22 @@ func (c CountryIndex) QueryIndex(queryParams map[string]string, ch chan ZipEntry
 			}
 		}
 		if countyTest {
-			if !contains(county, entry.County) {
+			if !contains(county, strings.ToLower(entry.County)) {
+				continue
+			}
+		}
+		if exactCountyTest {
+			if exactCounty != strings.ToLower(entry.County) {
+				continue
+			}
+		}
+		if timeZoneTest {
+			if timeZone != strings.ToLower(entry.TimeZone) {
+				continue
+			}
+		}
+		if zipTypeTest {
+			if zipType != strings.ToLower(entry.Type) {
 				continue
 			}
 		}
@@ -400,3 +550,12 @@ func (c CountryIndex) queryIndexNoClose(queryParams map[string]string, ch chan Z
 	}
 	ch <- ZipEntry{Type: "EOL"}
 }
+
+func isValidZipType(zipType string) bool {
+	for _, t := range ZipTypes {
+		if strings.EqualFold(t, zipType) {
+			return true
+		}
+	}
+	return false
+}
@@ -99,7 +99,7 @@ func Test_DatabaseLoad(t *testing.T) {
 				entryMap := make(map[string]ZipEntry)
 				for _, entry := range queryResult.ZipCodeEntries {
 					if mpEntry, found := entryMap[entry.ZipCode]; found {
-						t.Errorf("Found duplicate\n%s\n%s\n", entry, mpEntry)
+						t.Errorf("Found duplicate\n%v\n%v\n", entry, mpEntry)
 					} else {
 						entryMap[entry.ZipCode] = entry
 					}
@@ -110,3 +110,83 @@ func Test_DatabaseLoad(t *testing.T) {
 		}
 	}
 }
+
+func Test_QueryIndex_Filters(t *testing.T) {
+	index := CountryIndex{
+		CountryCode: "US",
+		Entries: []ZipEntry{
+			ZipEntry{ZipCode: "60601", Type: "STANDARD", City: "Chicago", County: "Cook", State: "IL", TimeZone: "America/Chicago", AreaCodes: []string{"312"}},
+			ZipEntry{ZipCode: "60690", Type: "PO BOX", City: "Chicago Heights", County: "Cookson", State: "IL", TimeZone: "America/Chicago", AreaCodes: []string{"312", "773"}},
+			ZipEntry{ZipCode: "22151", Type: "STANDARD", City: "Springfield", State: "VA", TimeZone: "America/New_York", AreaCodes: []string{"703", "1312"}},
+		},
+	}
+
+	testQuery := func(query map[string]string, expected ...string) {
+		ch := make(chan ZipEntry)
+		go index.QueryIndex(query, ch)
+		found := make([]string, 0, len(expected))
+		for entry := range ch {
+			found = append(found, entry.ZipCode)
+		}
+		if len(found) != len(expected) {
+			t.Errorf("Query %v returned %v, expected %v", query, found, expected)
+			return
+		}
+		for i, zip := range expected {
+			if found[i] != zip {
+				t.Errorf("Query %v returned %v, expected %v", query, found, expected)
+				return
+			}
+		}
+	}
+
+	testQuery(map[string]string{"TimeZone": "America/Chicago"}, "60601", "60690")
+	testQuery(map[string]string{"TimeZone": "america/chicago", "Type": "Standard"}, "60601")
+	testQuery(map[string]string{"Type": "PO BOX"}, "60690")
+	testQuery(map[string]string{"AreaCode": "312"}, "60601", "60690", "22151")
+	testQuery(map[string]string{"ExactAreaCode": "312"}, "60601", "60690")
+	testQuery(map[string]string{"ExactAreaCode": "773", "Type": "STANDARD"})
+	testQuery(map[string]string{"City": "chicago"}, "60601", "60690")
+	testQuery(map[string]string{"ExactCity": "chicago"}, "60601")
+	testQuery(map[string]string{"County": "Cook"}, "60601", "60690")
+	testQuery(map[string]string{"ExactCounty": "COOK"}, "60601")
+}
+
+func Test_ExecQuery_InvalidType(t *testing.T) {
+	database := &Database{CountryIndexMap: make(map[string]CountryIndex)}
+
+	if _, err := database.ExecQuery(map[string]string{"Type": "BOGUS"}); err == nil {
+		t.Error("Expected an invalid type error")
+	} else if err.Error() != "Invalid type: BOGUS" {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func Test_BuildFacets(t *testing.T) {
+	entries := []ZipEntry{
+		ZipEntry{ZipCode: "60601", Type: "STANDARD", City: "Chicago", State: "IL", County: "Cook"},
+		ZipEntry{ZipCode: "60690", Type: "PO BOX", City: "Chicago", State: "IL", County: "Cook"},
+		ZipEntry{ZipCode: "62701", Type: "STANDARD", City: "Springfield", State: "IL", County: "Sangamon"},
+		ZipEntry{ZipCode: "22151", Type: "STANDARD", City: "Springfield", State: "VA"},
+	}
+
+	facets, err := buildFacets("state, county", entries)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(facets) != 2 || facets[0].Field != "State" || facets[1].Field != "County" {
+		t.Errorf("Wrong facets: %v", facets)
+		return
+	}
+	if len(facets[0].Values) != 2 || facets[0].Values[0] != (FacetValue{"IL", 3}) || facets[0].Values[1] != (FacetValue{"VA", 1}) {
+		t.Errorf("Wrong state facet: %v", facets[0].Values)
+	}
+	if len(facets[1].Values) != 2 || facets[1].Values[0] != (FacetValue{"Cook", 2}) || facets[1].Values[1] != (FacetValue{"Sangamon", 1}) {
+		t.Errorf("Wrong county facet: %v", facets[1].Values)
+	}
+
+	if _, err := buildFacets("State,Bogus", entries); err == nil || err.Error() != "Invalid facet: Bogus" {
+		t.Errorf("Expected an invalid facet error, got %v", err)
+	}
+}
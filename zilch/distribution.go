@@ -0,0 +1,208 @@
+package zilch
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SquareGrid buckets zip codes into cells of equal latitude and longitude.
+	SquareGrid string = "square"
+	// HexGrid buckets zip codes into hexagonal cells.
+	HexGrid string = "hex"
+)
+
+// DistributionResolutions are the supported cell sizes, in degrees.
+var DistributionResolutions = []float64{0.1, 0.25, 0.5, 1, 5}
+
+// DistributionOptions describe the grid used to bucket zip codes. Bounds
+// are in the same north, west, south, east order as the Bounds query
+// parameter.
+type DistributionOptions struct {
+	Resolution float64
+	Grid       string
+	Bounds     []float32
+}
+
+// ParseDistributionOptions reads the resolution, grid and Bounds query
+// parameters. The default is the 1 degree square grid with no bounds.
+func ParseDistributionOptions(queryParams map[string]string) (DistributionOptions, error) {
+	options := DistributionOptions{Resolution: 1, Grid: SquareGrid}
+
+	if resolution, found := queryParams["resolution"]; found {
+		r, err := strconv.ParseFloat(resolution, 64)
+		valid := false
+		for _, res := range DistributionResolutions {
+			if err == nil && r == res {
+				valid = true
+			}
+		}
+		if !valid {
+			return options, badRequestError(ErrorInvalidParameter, "Invalid resolution: %s", resolution)
+		}
+		options.Resolution = r
+	}
+
+	if grid, found := queryParams["grid"]; found {
+		switch strings.ToLower(grid) {
+		case "square":
+			options.Grid = SquareGrid
+		case "hex", "hexagon":
+			options.Grid = HexGrid
+		default:
+			return options, badRequestError(ErrorInvalidParameter, "Invalid grid: %s", grid)
+		}
+	}
+
+	if bounds, found := queryParams["Bounds"]; found {
+		ba := strings.Split(bounds, ",")
+		if len(ba) != 4 {
+			return options, badRequestError(ErrorInvalidParameter, "Invalid bounds: %s", bounds)
+		}
+		options.Bounds = make([]float32, 4)
+		for i, b := range ba {
+			f, err := strconv.ParseFloat(strings.TrimSpace(b), 32)
+			if err != nil {
+				return options, badRequestError(ErrorInvalidParameter, "Invalid bounds: %s", bounds)
+			}
+			options.Bounds[i] = float32(f)
+		}
+	}
+	return options, nil
+}
+
+// IsDefault determines whether the options describe the 1 degree square
+// grid which is calculated when the database is loaded.
+func (o DistributionOptions) IsDefault() bool {
+	return o.isDefaultGrid() && o.Bounds == nil
+}
+
+func (o DistributionOptions) isDefaultGrid() bool {
+	return o.Resolution == 1 && o.Grid == SquareGrid
+}
+
+// FindDistributions buckets the zip codes matching the query filters, using
+// the grid described by the resolution, grid and Bounds query parameters.
+func (d *Database) FindDistributions(queryParams map[string]string) ([]DistributionEntry, error) {
+	options, err := ParseDistributionOptions(queryParams)
+	if err != nil {
+		return nil, err
+	}
+	if !HasQueryFilters(queryParams) {
+		if options.IsDefault() {
+			return d.GetDistributions(), nil
+		}
+		return d.GetDistributionsWith(options), nil
+	}
+
+	entries, err := d.findEntries(queryParams)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan ZipEntry)
+	go func() {
+		for _, entry := range entries {
+			ch <- entry
+		}
+		close(ch)
+	}()
+	return buildDistributions(ch, options), nil
+}
+
+// GetDistributionsWith buckets every zip code in the database using the
+// grid described by the options.
+func (d *Database) GetDistributionsWith(options DistributionOptions) []DistributionEntry {
+	ch := make(chan ZipEntry)
+	go func() {
+		for _, countryIndex := range d.CountryIndexMap {
+			for _, entry := range countryIndex.Entries {
+				ch <- entry
+			}
+		}
+		close(ch)
+	}()
+	return buildDistributions(ch, options)
+}
+
+func buildDistributions(ch chan ZipEntry, options DistributionOptions) []DistributionEntry {
+	type cell struct {
+		x, y int64
+	}
+	cells := make(map[cell]DistributionEntry)
+
+	for entry := range ch {
+		if !entry.hasCoordinates() {
+			continue
+		}
+		if options.Bounds != nil {
+			b := options.Bounds
+			if entry.Latitude > b[0] || entry.Latitude < b[2] || entry.Longitude < b[1] || entry.Longitude > b[3] {
+				continue
+			}
+		}
+
+		var key cell
+		var lat, lon float64
+		if options.Grid == HexGrid {
+			key.x, key.y, lat, lon = hexCell(float64(entry.Latitude), float64(entry.Longitude), options.Resolution)
+		} else {
+			key.x = int64(math.Floor((float64(entry.Longitude) + 180) / options.Resolution))
+			key.y = int64(math.Floor((float64(entry.Latitude) + 90) / options.Resolution))
+			lat = float64(key.y)*options.Resolution - 90
+			lon = float64(key.x)*options.Resolution - 180
+		}
+
+		if dist, found := cells[key]; found {
+			dist.ZipCodes++
+			cells[key] = dist
+		} else {
+			dist = DistributionEntry{
+				Latitude:  roundCoordinate(lat),
+				Longitude: roundCoordinate(lon),
+				ZipCodes:  1,
+			}
+			if !options.isDefaultGrid() {
+				dist.Resolution = float32(options.Resolution)
+				dist.Grid = options.Grid
+			}
+			cells[key] = dist
+		}
+	}
+
+	entries := make([]DistributionEntry, 0, len(cells))
+	for _, dist := range cells {
+		entries = append(entries, dist)
+	}
+	sort.Sort(DistributionSorter(entries))
+	return entries
+}
+
+// hexCell finds the pointy topped hexagon containing the point, where the
+// distance between the centers of neighboring hexagons in a row is the
+// resolution. It returns the axial coordinates and the center of the hexagon.
+func hexCell(latitude, longitude, resolution float64) (int64, int64, float64, float64) {
+	size := resolution / math.Sqrt(3)
+	q := (math.Sqrt(3)/3*longitude - latitude/3) / size
+	r := (2.0 / 3.0 * latitude) / size
+
+	// round the fractional cube coordinates to the nearest hexagon
+	x, z := q, r
+	y := -x - z
+	rx, ry, rz := math.Round(x), math.Round(y), math.Round(z)
+	dx, dy, dz := math.Abs(rx-x), math.Abs(ry-y), math.Abs(rz-z)
+	if dx > dy && dx > dz {
+		rx = -ry - rz
+	} else if dy <= dz {
+		rz = -rx - ry
+	}
+
+	centerLon := size * (math.Sqrt(3)*rx + math.Sqrt(3)/2*rz)
+	centerLat := size * 1.5 * rz
+	return int64(rx), int64(rz), centerLat, centerLon
+}
+
+func roundCoordinate(value float64) float32 {
+	return float32(math.Round(value*10000) / 10000)
+}
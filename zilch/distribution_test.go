@@ -0,0 +1,121 @@
+package zilch
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func testDistributionEntries(entries ...ZipEntry) chan ZipEntry {
+	ch := make(chan ZipEntry, len(entries))
+	for _, entry := range entries {
+		ch <- entry
+	}
+	close(ch)
+	return ch
+}
+
+func Test_ParseDistributionOptions(t *testing.T) {
+	if options, err := ParseDistributionOptions(map[string]string{}); err != nil || !options.IsDefault() {
+		t.Errorf("Expected the default options: %v %v", options, err)
+	}
+	if options, err := ParseDistributionOptions(map[string]string{"resolution": "0.25", "grid": "Hexagon", "Bounds": "50,-80,30,-70"}); err != nil {
+		t.Error(err)
+	} else if options.Resolution != 0.25 || options.Grid != HexGrid || options.Bounds[2] != 30 || options.IsDefault() {
+		t.Errorf("Wrong options: %v", options)
+	}
+	if _, err := ParseDistributionOptions(map[string]string{"resolution": "2"}); err == nil || err.Error() != "Invalid resolution: 2" {
+		t.Errorf("Expected an invalid resolution error, got %v", err)
+	}
+	if _, err := ParseDistributionOptions(map[string]string{"grid": "triangle"}); err == nil {
+		t.Error("Expected an invalid grid error")
+	}
+	if _, err := ParseDistributionOptions(map[string]string{"Bounds": "1,2,3"}); err == nil {
+		t.Error("Expected an invalid bounds error")
+	}
+}
+
+func Test_BuildDistributions_Square(t *testing.T) {
+	ch := testDistributionEntries(
+		ZipEntry{Latitude: 38.78, Longitude: -77.17},
+		ZipEntry{Latitude: 38.6, Longitude: -77.4},
+		ZipEntry{Latitude: 38.4, Longitude: -77.4},
+		ZipEntry{Latitude: 0, Longitude: 0},
+		ZipEntry{Latitude: 45, Longitude: -77.4},
+	)
+	options := DistributionOptions{Resolution: 0.5, Grid: SquareGrid, Bounds: []float32{40, -80, 30, -70}}
+	entries := buildDistributions(ch, options)
+
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 cells, found %v", entries)
+		return
+	}
+	if entries[1] != (DistributionEntry{Latitude: 38.5, Longitude: -77.5, ZipCodes: 2, Resolution: 0.5, Grid: SquareGrid}) {
+		t.Errorf("Wrong largest cell: %v", entries[1])
+	}
+	if entries[0].Latitude != 38 || entries[0].Longitude != -77.5 {
+		t.Errorf("Wrong smallest cell: %v", entries[0])
+	}
+}
+
+func Test_BuildDistributions_Hex(t *testing.T) {
+	points := [][2]float32{{38.78, -77.17}, {-25.34, 145.89}, {51.5, -0.12}, {0.01, 0.01}, {35.7, 139.7}}
+	for _, point := range points {
+		entries := buildDistributions(testDistributionEntries(ZipEntry{Latitude: point[0], Longitude: point[1]}), DistributionOptions{Resolution: 1, Grid: HexGrid})
+		if len(entries) != 1 {
+			t.Errorf("Expected 1 cell for %v, found %v", point, entries)
+			continue
+		}
+		// every point in a hexagon is within the circumradius of its center
+		dLat := float64(entries[0].Latitude - point[0])
+		dLon := float64(entries[0].Longitude - point[1])
+		if distance := math.Sqrt(dLat*dLat + dLon*dLon); distance > 1/math.Sqrt(3)+0.001 {
+			t.Errorf("The center %v is too far from %v", entries[0], point)
+		}
+	}
+}
+
+func Test_FindDistributions(t *testing.T) {
+	database := testRegionDatabase()
+
+	if entries, err := database.FindDistributions(map[string]string{"State": "VA"}); err != nil {
+		t.Error(err)
+	} else if len(entries) != 2 || entries[0].ZipCodes != 1 || entries[1].Resolution != 0 {
+		t.Errorf("Wrong VA distributions: %v", entries)
+	}
+
+	if entries, err := database.FindDistributions(map[string]string{"Country": "US", "City": "Springfield", "resolution": "5", "Bounds": "39,-85,30,-75"}); err != nil {
+		t.Error(err)
+	} else if len(entries) != 1 || entries[0].ZipCodes != 1 || entries[0].Latitude != 35 || entries[0].Longitude != -80 || entries[0].Resolution != 5 {
+		t.Errorf("Wrong Springfield distributions: %v", entries)
+	}
+
+	if _, err := database.FindDistributions(map[string]string{"Country": "XX"}); err == nil {
+		t.Error("Expected an error for an unknown country")
+	}
+}
+
+func Test_Distributions_Totals(t *testing.T) {
+	d := &Database{CountryIndexMap: make(map[string]CountryIndex), DistributionMap: make(map[uint32]DistributionEntry)}
+	entries := testDistributionEntries(
+		ZipEntry{ZipCode: "1", Country: "XX"},
+		ZipEntry{ZipCode: "2", Country: "XX", Latitude: 0.5, Longitude: 0.5},
+		ZipEntry{ZipCode: "3", Country: "XX", Latitude: 38.78, Longitude: -77.17},
+	)
+	distChannel := make(chan map[uint32]int)
+	go d.loadCountryData("XX", entries, distChannel)
+	d.finishDistributionChannels(distChannel, 1, time.Now())
+
+	total := func(distributions []DistributionEntry) (zipCodes uint32) {
+		for _, dist := range distributions {
+			zipCodes += dist.ZipCodes
+		}
+		return zipCodes
+	}
+	// the zip code without coordinates is left out of every distribution
+	unbounded := total(d.GetDistributions())
+	bounded := total(d.GetDistributionsWith(DistributionOptions{Resolution: 1, Grid: SquareGrid, Bounds: []float32{90, -180, -90, 180}}))
+	if unbounded != 2 || bounded != unbounded {
+		t.Errorf("Wrong totals %v, %v", unbounded, bounded)
+	}
+}
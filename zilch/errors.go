@@ -0,0 +1,93 @@
+package zilch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// The machine readable codes of an Error.
+const (
+	ErrorInvalidParameter = "INVALID_PARAMETER"
+	ErrorMissingParameter = "MISSING_PARAMETER"
+	ErrorInvalidFormat    = "INVALID_FORMAT"
+	ErrorInvalidBatch     = "INVALID_BATCH"
+	ErrorNotAcceptable    = "NOT_ACCEPTABLE"
+	ErrorCountryNotFound  = "COUNTRY_NOT_FOUND"
+	ErrorStateNotFound    = "STATE_NOT_FOUND"
+	ErrorZipCodeNotFound  = "ZIP_CODE_NOT_FOUND"
+	ErrorNotFound         = "NOT_FOUND"
+	ErrorAPIKeyRequired   = "API_KEY_REQUIRED"
+	ErrorInvalidAPIKey    = "INVALID_API_KEY"
+	ErrorRateLimited      = "RATE_LIMITED"
+	ErrorQuotaExceeded    = "QUOTA_EXCEEDED"
+	ErrorLoading          = "LOADING"
+	ErrorInternal         = "INTERNAL_ERROR"
+)
+
+// errorFormats are the formats of an error response. The other formats get
+// a JSON error.
+var errorFormats = []string{"JSON", "XML", "YAML", "MSGPACK"}
+
+// Error is an error which is sent to the client with an HTTP status and a
+// machine readable code, so that mistakes in the request can be told apart
+// from faults of the server.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+func badRequestError(code, format string, args ...interface{}) error {
+	return Error{400, code, fmt.Sprintf(format, args...)}
+}
+
+func notFoundError(code, format string, args ...interface{}) error {
+	return Error{404, code, fmt.Sprintf(format, args...)}
+}
+
+func invalidFormatError(format string) error {
+	return Error{400, ErrorInvalidFormat, "Invalid format: " + format}
+}
+
+// loadingError is sent while the database is being read.
+var loadingError = Error{503, ErrorLoading, "The zip code database is still loading, try again shortly"}
+
+// toError converts any error into an Error. Missing files are not found and
+// every other error is an internal error.
+func toError(err error) Error {
+	var e Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if os.IsNotExist(err) {
+		return Error{404, ErrorNotFound, "Not found"}
+	}
+	return Error{500, ErrorInternal, err.Error()}
+}
+
+// Marshal marshals the Error object.
+func (e Error) Marshal(format string) (string, error) {
+	return marshal(format, e)
+}
+
+func (e Error) toXML() (string, error) {
+	return encodeXMLDocument(&e)
+}
+
+func (e Error) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("Status:  %v\n", e.Status))
+	buf.WriteString(fmt.Sprintf("Code:    %v\n", yamlScalar(e.Code)))
+	buf.WriteString(fmt.Sprintf("Message: %v\n", yamlScalar(e.Message)))
+	return buf.String(), nil
+}
+
+func (e Error) toMsgPack() (string, error) {
+	return encodeMsgPack(e)
+}
@@ -0,0 +1,118 @@
+package zilch
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_Error_Marshal(t *testing.T) {
+	e := Error{404, ErrorCountryNotFound, "No country XX found"}
+
+	for _, format := range errorFormats {
+		data, err := e.Marshal(format)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if found, err := UnmarshalError(format, []byte(data)); err != nil {
+			t.Errorf("%s: %v", format, err)
+		} else if found != e {
+			t.Errorf("Wrong %s round trip: %v\n%s", format, found, data)
+		}
+	}
+
+	if data, _ := e.Marshal("YAML"); data != "Status:  404\nCode:    COUNTRY_NOT_FOUND\nMessage: No country XX found\n" {
+		t.Errorf("Wrong YAML: %s", data)
+	}
+	if _, err := e.Marshal("CSV"); err == nil || toError(err).Code != ErrorInvalidFormat {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func Test_To_Error(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{badRequestError(ErrorInvalidParameter, "Invalid type: %s", "BOGUS"), 400, ErrorInvalidParameter},
+		{notFoundError(ErrorStateNotFound, "No state"), 404, ErrorStateNotFound},
+		{loadingError, 503, ErrorLoading},
+		{os.ErrNotExist, 404, ErrorNotFound},
+		{errors.New("Broken"), 500, ErrorInternal},
+	}
+	for _, test := range tests {
+		if e := toError(test.err); e.Status != test.status || e.Code != test.code {
+			t.Errorf("Wrong error for %v: %v", test.err, e)
+		}
+	}
+}
+
+func Test_Database_Errors(t *testing.T) {
+	database := testRegionDatabase()
+
+	tests := []struct {
+		params map[string]string
+		status int
+		code   string
+	}{
+		{map[string]string{}, 400, ErrorMissingParameter},
+		{map[string]string{"Country": "XX"}, 404, ErrorCountryNotFound},
+		{map[string]string{"Type": "BOGUS"}, 400, ErrorInvalidParameter},
+		{map[string]string{"Country": "US", "facets": "Bogus"}, 400, ErrorInvalidParameter},
+	}
+	for _, test := range tests {
+		_, err := database.ExecQuery(test.params)
+		if e := toError(err); err == nil || e.Status != test.status || e.Code != test.code {
+			t.Errorf("Wrong error for %v: %v", test.params, err)
+		}
+	}
+
+	if _, err := database.GetStateRegion("US", "XX"); err == nil || toError(err).Code != ErrorStateNotFound {
+		t.Errorf("Wrong error: %v", err)
+	}
+	if _, err := database.GetZipCodeRegion("US", "00000"); err == nil || toError(err).Code != ErrorZipCodeNotFound {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func Test_Controller_Loading(t *testing.T) {
+	c := ZipCodeController{&Database{}}
+	writer, recorder := testResponseWriter("", "")
+	c.Query(writer.ctx, "json")
+	if recorder.Code != 503 || !strings.Contains(recorder.Body.String(), "\"Code\":\"LOADING\"") {
+		t.Errorf("Wrong response while loading %v: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func Test_ResponseWriter_SendError(t *testing.T) {
+	writer, recorder := testResponseWriter("yaml", "")
+	writer.SendError(notFoundError(ErrorCountryNotFound, "No country %s found", "XX"))
+	if recorder.Code != 404 || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/yaml") ||
+		!strings.Contains(recorder.Body.String(), "Code:    COUNTRY_NOT_FOUND") {
+		t.Errorf("Wrong error response %v %v: %s", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+
+	// formats which can not hold an error get JSON
+	writer, recorder = testResponseWriter("csv", "")
+	writer.SendError(errors.New("Broken"))
+	if recorder.Code != 500 || recorder.Header().Get("Content-Type") != "application/json; charset=utf-8" ||
+		recorder.Body.String() != "{\"Status\":500,\"Code\":\"INTERNAL_ERROR\",\"Message\":\"Broken\"}\n" {
+		t.Errorf("Wrong error response %v %v: %s", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+
+	writer, recorder = testResponseWriter("", "text/xml")
+	writer.SendError(loadingError)
+	if recorder.Code != 503 || recorder.Header().Get("Retry-After") != "5" ||
+		!strings.Contains(recorder.Body.String(), "<Code>LOADING</Code>") {
+		t.Errorf("Wrong error response %v %v: %s", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+
+	writer, recorder = testResponseWriter("", "text/csv")
+	writer.SendRegionResponse(Region{})
+	if recorder.Code != 406 || !strings.Contains(recorder.Body.String(), "\"Code\":\"NOT_ACCEPTABLE\"") {
+		t.Errorf("Wrong error response %v %v: %s", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+}
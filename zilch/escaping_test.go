@@ -0,0 +1,207 @@
+package zilch
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var awkwardValues = []string{
+	"Springfield", "Saint-Louis", "T0A 1A0", "22151", "01945", "1e5", ".5", "-77", "+1",
+	"", " leading", "trailing ", "yes", "NO", "null", "~",
+	"a: b", "ends:", "key:value", "#hash", "a #comment", "- dash", "[list]", "{map}", "one, two",
+	"'single'", `"double"`, `back\slash`, "line\nbreak", "tab\there", "<tag>", "A & B", "]]>",
+	"*alias", "&anchor", "!tag", "|pipe", ">fold", "%percent", "@at", "`tick`", "?question",
+	"Zürich", "東京都",
+}
+
+// readYAMLValue reads back a scalar or flow sequence written by the YAML
+// marshallers. Plain numbers and booleans are read as numbers and booleans,
+// and any other plain scalar which would not be read as a string fails.
+func readYAMLValue(t *testing.T, value string) interface{} {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		items := make([]string, 0)
+		rest := strings.TrimSpace(value[1 : len(value)-1])
+		for len(rest) > 0 {
+			item := rest
+			if strings.HasPrefix(rest, `"`) {
+				quoted, err := strconv.QuotedPrefix(rest)
+				if err != nil {
+					t.Errorf("Invalid quoted item in %s: %v", value, err)
+					return nil
+				}
+				item = quoted
+			} else if i := strings.Index(rest, ","); i != -1 {
+				item = rest[:i]
+			}
+			items = append(items, readYAMLValue(t, item).(string))
+			rest = strings.TrimPrefix(strings.TrimSpace(rest[len(item):]), ",")
+			rest = strings.TrimSpace(rest)
+		}
+		return items
+	}
+	if strings.HasPrefix(value, `"`) {
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			t.Errorf("Invalid quoted scalar %s: %v", value, err)
+		}
+		return s
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	if len(value) == 0 || yamlReservedWords[strings.ToLower(value)] || strings.ContainsAny(value[:1], "0123456789-+.\"'[]{}#&*!|>%@`?:,") {
+		t.Errorf("Ambiguous plain scalar: '%s'", value)
+	}
+	return value
+}
+
+// readYAMLMap reads the "key: value" lines of the YAML, ignoring the
+// indentation and list markers.
+func readYAMLMap(t *testing.T, yaml string) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, line := range strings.Split(yaml, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "- ")
+		i := strings.Index(line, ":")
+		if i == -1 || i == len(line)-1 {
+			continue
+		}
+		values[line[:i]] = readYAMLValue(t, strings.TrimSpace(line[i+1:]))
+	}
+	return values
+}
+
+func Test_Marshal_XML_Escaping(t *testing.T) {
+	for _, value := range awkwardValues {
+		entry := ZipEntry{
+			ZipCode:            value,
+			City:               value,
+			AcceptableCities:   []string{value, "Other"},
+			UnacceptableCities: []string{},
+			AreaCodes:          []string{value},
+			Latitude:           38.78,
+			Longitude:          -77.17,
+		}
+		data, err := entry.Marshal("XML")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		var parsed xmlZipEntry
+		if err := xml.Unmarshal([]byte(data), &parsed); err != nil {
+			t.Errorf("Invalid XML for '%s': %v\n%s", value, err, data)
+			continue
+		}
+		if parsed.City != value || parsed.ZipCode != value || parsed.AcceptableCities[0] != value ||
+			parsed.AreaCodes[0] != value || parsed.Latitude != entry.Latitude {
+			t.Errorf("Wrong XML round trip for '%s': %v", value, parsed)
+		}
+	}
+}
+
+func Test_Marshal_YAML_Escaping(t *testing.T) {
+	for _, value := range awkwardValues {
+		entry := ZipEntry{
+			ZipCode:          value,
+			City:             value,
+			AcceptableCities: []string{value, "Other"},
+			AreaCodes:        []string{},
+			Latitude:         38.78,
+		}
+		data, err := entry.Marshal("YAML")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		parsed := readYAMLMap(t, data)
+		if parsed["City"] != value || parsed["ZipCode"] != value {
+			t.Errorf("Wrong YAML round trip for '%s': %v\n%s", value, parsed, data)
+		}
+		if !reflect.DeepEqual(parsed["AcceptableCities"], []string{value, "Other"}) {
+			t.Errorf("Wrong YAML list round trip for '%s': %v\n%s", value, parsed["AcceptableCities"], data)
+		}
+		if !reflect.DeepEqual(parsed["AreaCodes"], []string{}) {
+			t.Errorf("Wrong empty YAML list: %v", parsed["AreaCodes"])
+		}
+	}
+}
+
+func Test_Marshal_Region_Escaping(t *testing.T) {
+	region := Region{Type: "City", Code: "01945", Name: "Ruhland: <Süd> & #1", Links: []Link{Link{"zipcodes", "/query?City=A&State=B"}}}
+
+	data, err := region.Marshal("XML")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var parsed struct {
+		Code  string
+		Name  string
+		Links []Link `xml:"Links>Link"`
+	}
+	if err := xml.Unmarshal([]byte(data), &parsed); err != nil {
+		t.Errorf("Invalid XML: %v\n%s", err, data)
+	} else if parsed.Code != region.Code || parsed.Name != region.Name || parsed.Links[0] != region.Links[0] {
+		t.Errorf("Wrong XML round trip: %v", parsed)
+	}
+
+	data, err = region.Marshal("YAML")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	values := readYAMLMap(t, data)
+	if values["Code"] != region.Code || values["Name"] != region.Name || values["Href"] != region.Links[0].Href {
+		t.Errorf("Wrong YAML round trip: %v\n%s", values, data)
+	}
+}
+
+func Test_Marshal_CountryMap(t *testing.T) {
+	c := CountryMarshaller{"US": 41000, "NO": 5000, "1A": 3}
+
+	data, err := c.Marshal("XML")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var parsed struct {
+		Countries []struct {
+			Code     string
+			ZipCodes int
+		} `xml:"Country"`
+	}
+	if err := xml.Unmarshal([]byte(data), &parsed); err != nil {
+		t.Errorf("Invalid XML: %v\n%s", err, data)
+	} else if len(parsed.Countries) != 3 || parsed.Countries[0].Code != "1A" || parsed.Countries[1].Code != "NO" || parsed.Countries[2].ZipCodes != 41000 {
+		t.Errorf("Wrong XML round trip: %v", parsed)
+	}
+
+	data, err = c.Marshal("YAML")
+	if err != nil {
+		t.Error(err)
+	} else if data != "\"1A\": 3\n\"NO\": 5000\nUS: 41000\n" {
+		t.Errorf("Wrong YAML: %s", data)
+	}
+}
+
+func Test_YAML_Scalar(t *testing.T) {
+	plain := []string{"Springfield", "America/New_York", "T0A 1A0", "N Springfield", "Zürich", "key:value"}
+	for _, value := range plain {
+		if yamlScalar(value) != value {
+			t.Errorf("Expected '%s' to be plain, found %s", value, yamlScalar(value))
+		}
+	}
+	quoted := []string{"", "22151", "NO", "true", "a: b", "#1", "x #1", "[a]", "a, b", "-05:00", " a", "a\nb"}
+	for _, value := range quoted {
+		if !strings.HasPrefix(yamlScalar(value), `"`) {
+			t.Errorf("Expected '%s' to be quoted, found %s", value, yamlScalar(value))
+		}
+	}
+}
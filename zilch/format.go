@@ -0,0 +1,255 @@
+package zilch
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Marshaller is a response object which can marshal itself into any of its
+// response formats.
+type Marshaller interface {
+	Marshal(format string) (string, error)
+}
+
+// Format describes a response format: how it is selected by a request, and
+// how the response is sent.
+type Format struct {
+	// Name is the upper case name of the format, such as "JSON".
+	Name string
+	// MediaTypes select the format in an Accept header. The first one is the
+	// content type of the response.
+	MediaTypes []string
+	// Extensions select the format as the file extension of the URL. The
+	// first one is the extension of downloaded files.
+	Extensions []string
+	// Binary formats are sent without a charset.
+	Binary bool
+	// Attachment formats are sent as a file to download.
+	Attachment bool
+	// Encode marshals a response object, such as a QueryResult or a Region,
+	// into the format.
+	Encode func(v interface{}) (string, error)
+}
+
+// contentType is the Content-Type header of a response in the format.
+func (f Format) contentType() string {
+	if f.Binary {
+		return f.MediaTypes[0]
+	}
+	return f.MediaTypes[0] + "; charset=utf-8"
+}
+
+var builtinFormats = []Format{
+	{Name: "JSON", MediaTypes: []string{"application/json", "text/json", "application/javascript", "text/javascript"}, Extensions: []string{"json", "js"}, Encode: encodeJSONLayout},
+	{Name: "XML", MediaTypes: []string{"text/xml", "application/xml"}, Extensions: []string{"xml"}, Encode: encodeXML},
+	{Name: "YAML", MediaTypes: []string{"text/yaml", "application/yaml", "application/x-yaml", "text/x-yaml"}, Extensions: []string{"yaml"}, Encode: encodeYAML},
+	{Name: "MSGPACK", MediaTypes: []string{"application/msgpack", "application/x-msgpack"}, Extensions: []string{"msgpack"}, Binary: true, Encode: encodeMsgPackLayout},
+	{Name: "GEOJSON", MediaTypes: []string{"application/geo+json"}, Extensions: []string{"geojson"}, Encode: encodeGeoJSON},
+	{Name: "NDJSON", MediaTypes: []string{"application/x-ndjson", "application/ndjson"}, Extensions: []string{"ndjson"}, Encode: encodeStreamOnly("NDJSON")},
+	{Name: "CSV", MediaTypes: []string{"text/csv"}, Extensions: []string{"csv"}, Attachment: true, Encode: encodeDelimited("CSV", ',')},
+	{Name: "TSV", MediaTypes: []string{"text/tab-separated-values"}, Extensions: []string{"tsv"}, Attachment: true, Encode: encodeDelimited("TSV", '\t')},
+	{Name: "KML", MediaTypes: []string{"application/vnd.google-earth.kml+xml"}, Extensions: []string{"kml"}, Attachment: true, Encode: encodeKML},
+	{Name: "GPX", MediaTypes: []string{"application/gpx+xml"}, Extensions: []string{"gpx"}, Attachment: true, Encode: encodeGPX},
+}
+
+// The layouts of the built in formats. A response object implements the
+// layouts of the formats it can be sent in.
+type (
+	jsonLayout      interface{ toJSON() (string, error) }
+	xmlLayout       interface{ toXML() (string, error) }
+	yamlLayout      interface{ toYAML() (string, error) }
+	msgPackLayout   interface{ toMsgPack() (string, error) }
+	geoJSONLayout   interface{ toGeoJSON() (string, error) }
+	delimitedLayout interface {
+		toDelimited(delimiter rune) (string, error)
+	}
+	kmlLayout interface{ toKML() string }
+	gpxLayout interface{ toGPX() string }
+)
+
+// formatRegistry holds the built in and custom formats by name, and their
+// names by file extension.
+var formatRegistry = struct {
+	sync.RWMutex
+	formats    map[string]Format
+	extensions map[string]string
+	custom     []string
+}{formats: map[string]Format{}, extensions: map[string]string{}}
+
+func init() {
+	for _, f := range builtinFormats {
+		if err := registerFormat(f); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterFormat adds a custom response format, which every response can be
+// sent in. The format is selected by its file extension or by its media types
+// in an Accept header, where it is only picked over the built in formats when
+// the client prefers it. Its Encode function is given the response object,
+// and should return an error for the objects it does not support. The name
+// and extensions may not already be registered.
+func RegisterFormat(f Format) error {
+	if f.Encode == nil {
+		return fmt.Errorf("The %s format has no Encode function", f.Name)
+	}
+	if err := registerFormat(f); err != nil {
+		return err
+	}
+	formatRegistry.Lock()
+	defer formatRegistry.Unlock()
+	formatRegistry.custom = append(formatRegistry.custom, strings.ToUpper(f.Name))
+	return nil
+}
+
+func registerFormat(f Format) error {
+	f.Name = strings.ToUpper(f.Name)
+	if len(f.Name) == 0 || len(f.MediaTypes) == 0 || len(f.Extensions) == 0 {
+		return fmt.Errorf("The %s format needs a name, media types and extensions", f.Name)
+	}
+
+	formatRegistry.Lock()
+	defer formatRegistry.Unlock()
+	if _, found := formatRegistry.formats[f.Name]; found {
+		return fmt.Errorf("The %s format is already registered", f.Name)
+	}
+	extensions := make([]string, len(f.Extensions))
+	for i, extension := range f.Extensions {
+		extensions[i] = strings.ToLower(extension)
+		if name, found := formatRegistry.extensions[extensions[i]]; found {
+			return fmt.Errorf("The %s extension is already registered by the %s format", extension, name)
+		}
+	}
+	f.Extensions = extensions
+
+	formatRegistry.formats[f.Name] = f
+	for _, extension := range f.Extensions {
+		formatRegistry.extensions[extension] = f.Name
+	}
+	return nil
+}
+
+// lookupFormat finds a format by its name or by one of its extensions.
+func lookupFormat(name string) (Format, bool) {
+	formatRegistry.RLock()
+	defer formatRegistry.RUnlock()
+	if f, found := formatRegistry.formats[strings.ToUpper(name)]; found {
+		return f, true
+	}
+	f, found := formatRegistry.formats[formatRegistry.extensions[strings.ToLower(name)]]
+	return f, found
+}
+
+// withCustomFormats adds the custom formats to the built in formats of a
+// response, after them so that the built in formats win a tie.
+func withCustomFormats(formats []string) []string {
+	formatRegistry.RLock()
+	defer formatRegistry.RUnlock()
+	if len(formatRegistry.custom) == 0 {
+		return formats
+	}
+	all := make([]string, 0, len(formats)+len(formatRegistry.custom))
+	return append(append(all, formats...), formatRegistry.custom...)
+}
+
+// marshal marshals a response object with the Encode function of a format.
+func marshal(format string, v interface{}) (string, error) {
+	f, found := lookupFormat(format)
+	if !found {
+		return "", invalidFormatError(strings.ToUpper(format))
+	}
+	return f.Encode(v)
+}
+
+// encodeJSON marshals the object into JSON, ending with a new line.
+func encodeJSON(v interface{}) (string, error) {
+	buf := bytes.Buffer{}
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// encodeJSONLayout marshals the object into JSON, unless it lays out its
+// JSON itself.
+func encodeJSONLayout(v interface{}) (string, error) {
+	if l, ok := v.(jsonLayout); ok {
+		return l.toJSON()
+	}
+	return encodeJSON(v)
+}
+
+// encodeXMLDocument marshals the object into an XML document, with the XML
+// declaration.
+func encodeXMLDocument(v interface{}) (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func encodeXML(v interface{}) (string, error) {
+	if l, ok := v.(xmlLayout); ok {
+		return l.toXML()
+	}
+	return "", invalidFormatError("XML")
+}
+
+func encodeYAML(v interface{}) (string, error) {
+	if l, ok := v.(yamlLayout); ok {
+		return l.toYAML()
+	}
+	return "", invalidFormatError("YAML")
+}
+
+func encodeMsgPackLayout(v interface{}) (string, error) {
+	if l, ok := v.(msgPackLayout); ok {
+		return l.toMsgPack()
+	}
+	return "", invalidFormatError("MSGPACK")
+}
+
+func encodeGeoJSON(v interface{}) (string, error) {
+	if l, ok := v.(geoJSONLayout); ok {
+		return l.toGeoJSON()
+	}
+	return "", invalidFormatError("GEOJSON")
+}
+
+func encodeDelimited(name string, delimiter rune) func(v interface{}) (string, error) {
+	return func(v interface{}) (string, error) {
+		if l, ok := v.(delimitedLayout); ok {
+			return l.toDelimited(delimiter)
+		}
+		return "", invalidFormatError(name)
+	}
+}
+
+func encodeKML(v interface{}) (string, error) {
+	if l, ok := v.(kmlLayout); ok {
+		return l.toKML(), nil
+	}
+	return "", invalidFormatError("KML")
+}
+
+func encodeGPX(v interface{}) (string, error) {
+	if l, ok := v.(gpxLayout); ok {
+		return l.toGPX(), nil
+	}
+	return "", invalidFormatError("GPX")
+}
+
+// encodeStreamOnly is the Encode function of the formats which are only
+// written by a streamed response.
+func encodeStreamOnly(name string) func(v interface{}) (string, error) {
+	return func(v interface{}) (string, error) {
+		return "", invalidFormatError(name)
+	}
+}
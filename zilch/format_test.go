@@ -0,0 +1,110 @@
+package zilch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// registerTestFormat registers a custom format, and returns a function which
+// removes it again.
+func registerTestFormat(t *testing.T) func() {
+	err := RegisterFormat(Format{
+		Name:       "legacy",
+		MediaTypes: []string{"application/vnd.legacy+xml"},
+		Extensions: []string{"LXML"},
+		Attachment: true,
+		Encode: func(v interface{}) (string, error) {
+			switch r := v.(type) {
+			case Region:
+				return fmt.Sprintf("<region code=%q/>", r.Code), nil
+			case QueryResult:
+				return fmt.Sprintf("<zips total=\"%v\"/>", r.TotalFound), nil
+			}
+			return "", errors.New("Unsupported")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		formatRegistry.Lock()
+		defer formatRegistry.Unlock()
+		delete(formatRegistry.formats, "LEGACY")
+		delete(formatRegistry.extensions, "lxml")
+		formatRegistry.custom = formatRegistry.custom[:len(formatRegistry.custom)-1]
+	}
+}
+
+func Test_RegisterFormat(t *testing.T) {
+	defer registerTestFormat(t)()
+
+	if f, found := lookupFormat("lxml"); !found || f.Name != "LEGACY" || f.contentType() != "application/vnd.legacy+xml; charset=utf-8" {
+		t.Errorf("Wrong format %v", f)
+	}
+	if f, found := lookupFormat("js"); !found || f.Name != "JSON" {
+		t.Errorf("Wrong format %v", f)
+	}
+
+	invalid := []Format{
+		{Name: "LEGACY", MediaTypes: []string{"text/plain"}, Extensions: []string{"legacy"}},
+		{Name: "Legacy", MediaTypes: []string{"text/plain"}, Extensions: []string{"legacy"}, Encode: encodeJSON},
+		{Name: "OTHER", MediaTypes: []string{"text/plain"}, Extensions: []string{"json"}, Encode: encodeJSON},
+		{Name: "OTHER", Extensions: []string{"other"}, Encode: encodeJSON},
+	}
+	for _, f := range invalid {
+		if err := RegisterFormat(f); err == nil {
+			t.Errorf("Expected an error registering %v", f)
+		}
+	}
+	if _, found := lookupFormat("OTHER"); found {
+		t.Error("Unexpected format OTHER")
+	}
+}
+
+func Test_Marshal_Custom_Format(t *testing.T) {
+	defer registerTestFormat(t)()
+
+	if data, err := (Region{Code: "VA"}).Marshal("legacy"); err != nil || data != `<region code="VA"/>` {
+		t.Errorf("Wrong region %v: %s", err, data)
+	}
+	if _, err := (NormalizedPostalCode{}).Marshal("LEGACY"); err == nil || err.Error() != "Unsupported" {
+		t.Errorf("Wrong error: %v", err)
+	}
+	// the built in formats only encode the objects which have their layout
+	if _, err := (Region{}).Marshal("CSV"); err == nil || toError(err).Code != ErrorInvalidFormat {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func Test_ResponseWriter_Custom_Format(t *testing.T) {
+	defer registerTestFormat(t)()
+
+	writer, recorder := testResponseWriter("lxml", "")
+	writer.SendRegionResponse(Region{Type: "State", Code: "VA"})
+	if recorder.Code != 200 || recorder.Body.String() != `<region code="VA"/>` ||
+		recorder.Header().Get("Content-Type") != "application/vnd.legacy+xml; charset=utf-8" ||
+		recorder.Header().Get("Content-Disposition") != `attachment; filename="state.lxml"` {
+		t.Errorf("Wrong response %v %v: %s", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+
+	writer, recorder = testResponseWriter("", "application/vnd.legacy+xml, application/json;q=0.5")
+	writer.SendQueryResponse(QueryResult{TotalFound: 3})
+	if recorder.Code != 200 || recorder.Body.String() != `<zips total="3"/>` {
+		t.Errorf("Wrong response %v %v: %s", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+
+	// the built in formats win a tie
+	writer, recorder = testResponseWriter("", "*/*")
+	writer.SendRegionResponse(Region{Type: "State", Code: "VA"})
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Wrong response %v: %s", recorder.Header(), recorder.Body.String())
+	}
+
+	writer, recorder = testResponseWriter("", "text/csv")
+	writer.SendRegionResponse(Region{})
+	if recorder.Code != 406 || !strings.Contains(recorder.Body.String(), "text/yaml, application/vnd.legacy+xml") {
+		t.Errorf("Wrong response %v: %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package zilch
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+// GeoJSONGeometry is a GeoJSON geometry object. Coordinates are in
+// longitude, latitude order.
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// GeoJSONFeature is a GeoJSON feature. The geometry is null for zip codes
+// and regions without coordinates.
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	BBox       []float32              `json:"bbox,omitempty"`
+	Geometry   *GeoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONFeatureCollection is a GeoJSON feature collection. The paging
+// details of a query are added as foreign members.
+type GeoJSONFeatureCollection struct {
+	Type            string           `json:"type"`
+	ResultsReturned *int             `json:",omitempty"`
+	TotalFound      *int             `json:",omitempty"`
+	StartIndex      *int             `json:",omitempty"`
+	EndIndex        *int             `json:",omitempty"`
+	Features        []GeoJSONFeature `json:"features"`
+}
+
+func newFeatureCollection(features []GeoJSONFeature) GeoJSONFeatureCollection {
+	return GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+func (g GeoJSONFeatureCollection) toJSON() (string, error) {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(&g); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+func pointGeometry(latitude, longitude float32) *GeoJSONGeometry {
+	if latitude == 0 && longitude == 0 {
+		return nil
+	}
+	return &GeoJSONGeometry{"Point", []float32{longitude, latitude}}
+}
+
+func (b BoundingBox) toGeoJSON() []float32 {
+	return []float32{b.West, b.South, b.East, b.North}
+}
+
+// toGeoJSON converts the zip entry into a Point feature, with every other
+// field as a property.
+func (z ZipEntry) toGeoJSON() GeoJSONFeature {
+	properties := map[string]interface{}{
+		"ZipCode":            z.ZipCode,
+		"Type":               z.Type,
+		"City":               z.City,
+		"AcceptableCities":   z.AcceptableCities,
+		"UnacceptableCities": z.UnacceptableCities,
+		"County":             z.County,
+		"State":              z.State,
+		"StateName":          z.StateName,
+		"Country":            z.Country,
+		"CountryName":        z.CountryName,
+		"TimeZone":           z.TimeZone,
+		"AreaCodes":          z.AreaCodes,
+	}
+	if z.LocalTime != nil {
+		properties["LocalTime"] = z.LocalTime
+	}
+	return GeoJSONFeature{
+		Type:       "Feature",
+		Geometry:   pointGeometry(z.Latitude, z.Longitude),
+		Properties: properties,
+	}
+}
+
+func (q QueryResult) toGeoJSON() (string, error) {
+	features := make([]GeoJSONFeature, 0, len(q.ZipCodeEntries))
+	for _, entry := range q.ZipCodeEntries {
+		features = append(features, entry.toGeoJSON())
+	}
+	collection := newFeatureCollection(features)
+	collection.ResultsReturned = &q.ResultsReturned
+	collection.TotalFound = &q.TotalFound
+	collection.StartIndex = &q.StartIndex
+	collection.EndIndex = &q.EndIndex
+	return collection.toJSON()
+}
+
+// toGeoJSON converts the distribution cell into a Polygon feature covering
+// the cell, with the number of zip codes in the cell as a property.
+func (d DistributionEntry) toGeoJSON() GeoJSONFeature {
+	resolution := float64(d.Resolution)
+	if len(d.Grid) == 0 {
+		resolution = 1
+	}
+	lat, lon := float64(d.Latitude), float64(d.Longitude)
+
+	var ring [][]float32
+	if d.Grid == HexGrid {
+		// the latitude and longitude are the center of a pointy topped hexagon
+		size := resolution / math.Sqrt(3)
+		for i := 0; i <= 6; i++ {
+			angle := math.Pi / 180 * float64(60*(i%6)-30)
+			ring = append(ring, []float32{
+				roundCoordinate(lon + size*math.Cos(angle)),
+				roundCoordinate(lat + size*math.Sin(angle)),
+			})
+		}
+	} else {
+		// the latitude and longitude are the south west corner of the square
+		west, south := roundCoordinate(lon), roundCoordinate(lat)
+		east, north := roundCoordinate(lon+resolution), roundCoordinate(lat+resolution)
+		ring = [][]float32{{west, south}, {east, south}, {east, north}, {west, north}, {west, south}}
+	}
+
+	properties := map[string]interface{}{
+		"ZipCodes":  d.ZipCodes,
+		"Latitude":  d.Latitude,
+		"Longitude": d.Longitude,
+	}
+	if len(d.Grid) > 0 {
+		properties["Resolution"] = d.Resolution
+		properties["Grid"] = d.Grid
+	}
+	return GeoJSONFeature{
+		Type:       "Feature",
+		Geometry:   &GeoJSONGeometry{"Polygon", [][][]float32{ring}},
+		Properties: properties,
+	}
+}
+
+func regionFeature(latitude, longitude float32, bounds BoundingBox, coverage float32, properties map[string]interface{}) GeoJSONFeature {
+	properties["Coverage"] = coverage
+	feature := GeoJSONFeature{
+		Type:       "Feature",
+		Geometry:   pointGeometry(latitude, longitude),
+		Properties: properties,
+	}
+	if coverage > 0 {
+		feature.BBox = bounds.toGeoJSON()
+	}
+	return feature
+}
+
+// toGeoJSON converts the country and each of its states into centroid
+// Point features, with their bounding boxes.
+func (c CountryEntry) toGeoJSON() []GeoJSONFeature {
+	features := make([]GeoJSONFeature, 0, len(c.States)+1)
+	features = append(features, regionFeature(c.Latitude, c.Longitude, c.Bounds, c.Coverage, map[string]interface{}{
+		"Type":        "Country",
+		"Country":     c.Country,
+		"CountryName": c.CountryName,
+		"ZipCodes":    c.ZipCodes,
+	}))
+	for _, se := range c.States {
+		features = append(features, regionFeature(se.Latitude, se.Longitude, se.Bounds, se.Coverage, map[string]interface{}{
+			"Type":      "State",
+			"Country":   c.Country,
+			"State":     se.State,
+			"StateName": se.StateName,
+			"ZipCodes":  se.ZipCodes,
+		}))
+	}
+	return features
+}
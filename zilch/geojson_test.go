@@ -0,0 +1,88 @@
+package zilch
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_Marshal_Results_GeoJSON(t *testing.T) {
+	entries := []ZipEntry{
+		ZipEntry{ZipCode: "22151", Type: "STANDARD", City: "Springfield", State: "VA", Country: "US", Latitude: 38.78, Longitude: -77.17},
+		ZipEntry{ZipCode: "22152", Type: "PO BOX", City: "Springfield", State: "VA", Country: "US"},
+	}
+	q := QueryResult{ResultsReturned: 2, TotalFound: 2, StartIndex: 1, EndIndex: 2, ZipCodeEntries: entries}
+
+	test := `{"type":"FeatureCollection","ResultsReturned":2,"TotalFound":2,"StartIndex":1,"EndIndex":2,"features":[` +
+		`{"type":"Feature","geometry":{"type":"Point","coordinates":[-77.17,38.78]},"properties":{"AcceptableCities":null,"AreaCodes":null,"City":"Springfield","Country":"US","CountryName":"","County":"","State":"VA","StateName":"","TimeZone":"","Type":"STANDARD","UnacceptableCities":null,"ZipCode":"22151"}},` +
+		`{"type":"Feature","geometry":null,"properties":{"AcceptableCities":null,"AreaCodes":null,"City":"Springfield","Country":"US","CountryName":"","County":"","State":"VA","StateName":"","TimeZone":"","Type":"PO BOX","UnacceptableCities":null,"ZipCode":"22152"}}]}`
+
+	if data, err := q.Marshal("geojson"); err != nil {
+		t.Error(err)
+	} else if data != test {
+		t.Errorf("Invalid GeoJSON Formatting\nFound:\n'%s'\n\nExpecting:\n'%s'\n", data, test)
+	}
+}
+
+func Test_Marshal_Distribution_GeoJSON(t *testing.T) {
+	d := DistributionMarshaller{
+		DistributionEntry{Latitude: 38, Longitude: -78, ZipCodes: 12},
+		DistributionEntry{Latitude: 0.433, Longitude: 0.25, ZipCodes: 3, Resolution: 0.5, Grid: HexGrid},
+	}
+	data, err := d.Marshal("GEOJSON")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var collection GeoJSONFeatureCollection
+	if err := json.Unmarshal([]byte(data), &collection); err != nil {
+		t.Error(err)
+		return
+	}
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+		t.Errorf("Wrong collection: %v", data)
+		return
+	}
+
+	square := collection.Features[0]
+	if square.Geometry.Type != "Polygon" || square.Properties["ZipCodes"] != float64(12) {
+		t.Errorf("Wrong square cell: %v", square)
+	}
+	ring := square.Geometry.Coordinates.([]interface{})[0].([]interface{})
+	if len(ring) != 5 || ring[0].([]interface{})[0] != float64(-78) || ring[2].([]interface{})[1] != float64(39) {
+		t.Errorf("Wrong square ring: %v", ring)
+	}
+
+	hex := collection.Features[1]
+	ring = hex.Geometry.Coordinates.([]interface{})[0].([]interface{})
+	if len(ring) != 7 || ring[0].([]interface{})[0] != ring[6].([]interface{})[0] || hex.Properties["Grid"] != HexGrid {
+		t.Errorf("Wrong hex cell: %v", hex)
+	}
+}
+
+func Test_Marshal_Countries_GeoJSON(t *testing.T) {
+	c := CountryEntryMarshaller{
+		CountryEntry{
+			Country:     "US",
+			CountryName: "United States of America",
+			ZipCodes:    uint32(421),
+			Latitude:    float32(39.5),
+			Longitude:   float32(-77.25),
+			Bounds:      BoundingBox{42.25, -83.5, 36.5, -75},
+			Coverage:    float32(0.5),
+			States: []StateEntry{
+				StateEntry{State: "PA", StateName: "Pennsylvania", ZipCodes: uint32(321)},
+			},
+		},
+	}
+
+	test := `{"type":"FeatureCollection","features":[` +
+		`{"type":"Feature","bbox":[-83.5,36.5,-75,42.25],"geometry":{"type":"Point","coordinates":[-77.25,39.5]},"properties":{"Country":"US","CountryName":"United States of America","Coverage":0.5,"Type":"Country","ZipCodes":421}},` +
+		`{"type":"Feature","geometry":null,"properties":{"Country":"US","Coverage":0,"State":"PA","StateName":"Pennsylvania","Type":"State","ZipCodes":321}}]}`
+
+	if data, err := c.Marshal("GEOJSON"); err != nil {
+		t.Error(err)
+	} else if data != test {
+		t.Errorf("Invalid GeoJSON Formatting\nFound:\n'%s'\n\nExpecting:\n'%s'\n", data, test)
+	}
+}
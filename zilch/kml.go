@@ -0,0 +1,147 @@
+package zilch
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarshalGrouped marshals the QueryResult object, grouping the zip codes by
+// State or County in the KML and GPX formats. The other formats ignore the
+// grouping.
+func (q QueryResult) MarshalGrouped(format, groupBy string) (string, error) {
+	switch strings.ToLower(groupBy) {
+	case "":
+	case "state":
+		groupBy = "State"
+	case "county":
+		groupBy = "County"
+	default:
+		return "", badRequestError(ErrorInvalidParameter, "Invalid group: %s", groupBy)
+	}
+
+	q.groupBy = groupBy
+	return q.Marshal(format)
+}
+
+// placemarkGroup is a named set of zip codes which have coordinates.
+type placemarkGroup struct {
+	name    string
+	entries []ZipEntry
+}
+
+// placemarkGroups groups the zip codes with coordinates by State or County,
+// in order of group name. Without a grouping there is one unnamed group.
+func (q QueryResult) placemarkGroups() []placemarkGroup {
+	groups := make(map[string][]ZipEntry)
+	for _, entry := range q.ZipCodeEntries {
+		if entry.Latitude == 0 && entry.Longitude == 0 {
+			continue
+		}
+		name := ""
+		switch q.groupBy {
+		case "State":
+			name = entry.StateName
+			if len(name) == 0 {
+				name = entry.State
+			}
+		case "County":
+			name = entry.County
+		}
+		groups[name] = append(groups[name], entry)
+	}
+
+	list := make([]placemarkGroup, 0, len(groups))
+	for name, entries := range groups {
+		list = append(list, placemarkGroup{name, entries})
+	}
+	sort.Sort(placemarkGroupSorter(list))
+	return list
+}
+
+type placemarkGroupSorter []placemarkGroup
+
+func (p placemarkGroupSorter) Len() int           { return len(p) }
+func (p placemarkGroupSorter) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p placemarkGroupSorter) Less(i, j int) bool { return p[i].name < p[j].name }
+
+func (z ZipEntry) placemarkDescription() string {
+	parts := make([]string, 0, 4)
+	for _, part := range []string{z.City, z.County, z.StateName, z.CountryName} {
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+	description := strings.Join(parts, ", ")
+	if len(z.Type) > 0 {
+		description += " (" + z.Type + ")"
+	}
+	return description
+}
+
+func (q QueryResult) toKML() string {
+	buf := bytes.Buffer{}
+	writetag := func(tag, value string) {
+		buf.WriteString("<" + tag + ">")
+		xml.EscapeText(&buf, []byte(value))
+		buf.WriteString("</" + tag + ">")
+	}
+
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><kml xmlns="http://www.opengis.net/kml/2.2"><Document>`)
+	writetag("name", "Zip Codes")
+	for _, group := range q.placemarkGroups() {
+		if len(q.groupBy) > 0 {
+			buf.WriteString("<Folder>")
+			name := group.name
+			if len(name) == 0 {
+				name = "No " + q.groupBy
+			}
+			writetag("name", name)
+		}
+		for _, entry := range group.entries {
+			buf.WriteString("<Placemark>")
+			writetag("name", entry.ZipCode)
+			writetag("description", entry.placemarkDescription())
+			buf.WriteString("<Point>")
+			writetag("coordinates", strconv.FormatFloat(float64(entry.Longitude), 'f', -1, 32)+","+
+				strconv.FormatFloat(float64(entry.Latitude), 'f', -1, 32))
+			buf.WriteString("</Point></Placemark>")
+		}
+		if len(q.groupBy) > 0 {
+			buf.WriteString("</Folder>")
+		}
+	}
+	buf.WriteString("</Document></kml>")
+	return buf.String()
+}
+
+// toGPX writes the zip codes as waypoints. GPX has no folders, so the group
+// name is written as the type of each waypoint.
+func (q QueryResult) toGPX() string {
+	buf := bytes.Buffer{}
+	writetag := func(tag, value string) {
+		buf.WriteString("<" + tag + ">")
+		xml.EscapeText(&buf, []byte(value))
+		buf.WriteString("</" + tag + ">")
+	}
+
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><gpx version="1.1" creator="ZiLCh" xmlns="http://www.topografix.com/GPX/1/1">`)
+	for _, group := range q.placemarkGroups() {
+		for _, entry := range group.entries {
+			buf.WriteString(fmt.Sprintf(`<wpt lat="%v" lon="%v">`,
+				strconv.FormatFloat(float64(entry.Latitude), 'f', -1, 32),
+				strconv.FormatFloat(float64(entry.Longitude), 'f', -1, 32)))
+			writetag("name", entry.ZipCode)
+			writetag("desc", entry.placemarkDescription())
+			if len(group.name) > 0 {
+				writetag("type", group.name)
+			}
+			buf.WriteString("</wpt>")
+		}
+	}
+	buf.WriteString("</gpx>")
+	return buf.String()
+}
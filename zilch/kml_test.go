@@ -0,0 +1,72 @@
+package zilch
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func testPlacemarkResult() QueryResult {
+	entries := []ZipEntry{
+		ZipEntry{ZipCode: "22151", Type: "STANDARD", City: "Springfield", County: "Fairfax", State: "VA", StateName: "Virginia", Country: "US", Latitude: 38.78, Longitude: -77.17},
+		ZipEntry{ZipCode: "62701", Type: "STANDARD", City: "Springfield", County: "Sangamon", State: "IL", StateName: "Illinois", Country: "US", Latitude: 39.8, Longitude: -89.6},
+		ZipEntry{ZipCode: "22152", Type: "PO BOX", City: "Springfield & Burke", State: "VA", StateName: "Virginia", Country: "US", Latitude: 38.77, Longitude: -77.23},
+		ZipEntry{ZipCode: "23219", City: "Richmond", State: "VA", StateName: "Virginia", Country: "US"},
+	}
+	return QueryResult{ResultsReturned: 4, TotalFound: 4, StartIndex: 1, EndIndex: 4, ZipCodeEntries: entries}
+}
+
+func Test_Marshal_Results_KML(t *testing.T) {
+	q := testPlacemarkResult()
+
+	data, err := q.Marshal("kml")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	test := `<Placemark><name>22151</name><description>Springfield, Fairfax, Virginia (STANDARD)</description><Point><coordinates>-77.17,38.78</coordinates></Point></Placemark>`
+	if !strings.Contains(data, test) {
+		t.Errorf("Invalid KML Formatting\nFound:\n'%s'\n\nExpecting:\n'%s'\n", data, test)
+	}
+	if strings.Count(data, "<Placemark>") != 3 || strings.Contains(data, "<Folder>") || strings.Contains(data, "23219") {
+		t.Errorf("Wrong placemarks: %s", data)
+	}
+	if err := xml.Unmarshal([]byte(data), new(interface{})); err != nil {
+		t.Errorf("Invalid KML: %v", err)
+	}
+
+	data, err = q.MarshalGrouped("KML", "state")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	illinois := strings.Index(data, "<Folder><name>Illinois</name>")
+	virginia := strings.Index(data, "<Folder><name>Virginia</name>")
+	if illinois == -1 || virginia < illinois || strings.Count(data, "<Folder>") != 2 {
+		t.Errorf("Wrong folders: %s", data)
+	}
+	if !strings.Contains(data, "Springfield &amp; Burke") {
+		t.Errorf("Description not escaped: %s", data)
+	}
+}
+
+func Test_Marshal_Results_GPX(t *testing.T) {
+	q := testPlacemarkResult()
+
+	data, err := q.MarshalGrouped("GPX", "County")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	test := `<wpt lat="38.78" lon="-77.17"><name>22151</name><desc>Springfield, Fairfax, Virginia (STANDARD)</desc><type>Fairfax</type></wpt>`
+	if !strings.Contains(data, test) {
+		t.Errorf("Invalid GPX Formatting\nFound:\n'%s'\n\nExpecting:\n'%s'\n", data, test)
+	}
+	if strings.Count(data, "<wpt ") != 3 || !strings.HasPrefix(data, `<?xml version="1.0" encoding="UTF-8"?><gpx version="1.1"`) {
+		t.Errorf("Wrong waypoints: %s", data)
+	}
+
+	if _, err := q.MarshalGrouped("GPX", "City"); err == nil || err.Error() != "Invalid group: City" {
+		t.Errorf("Expected an invalid group error, found %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package zilch
+
+import (
+	"container/list"
+	"sync"
+	"unsafe"
+)
+
+var (
+	// QueryCacheSize is the memory in bytes for the query results cached by
+	// each database.
+	QueryCacheSize int64 = 64 << 20
+	// ImageCacheSize is the memory in bytes for the images cached by each
+	// database.
+	ImageCacheSize int64 = 32 << 20
+)
+
+// LRUCache holds values up to a total size, evicting the least recently used
+// values to make room for new ones. Every value belongs to a version of the
+// database, and the cache is emptied as soon as it is used with a different
+// version, so that nothing from an older database is ever returned. The
+// database is never reloaded, so the caches of a database last as long as
+// the process, and new files are only read by restarting the server. A nil
+// cache never holds anything. It is safe for concurrent use.
+type LRUCache struct {
+	name    string
+	maxSize int64
+	size    int64
+	version string
+	items   map[string]*list.Element
+	order   *list.List
+	stats   CacheStats
+	mutex   sync.Mutex
+}
+
+// CacheStats are the statistics of an LRUCache. Sizes are in bytes.
+type CacheStats struct {
+	Name      string
+	Entries   int
+	Size      int64
+	MaxSize   int64
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// CacheStatsMarshaller is used to marshal CacheStats objects.
+type CacheStatsMarshaller []CacheStats
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+// NewLRUCache creates an empty cache which holds values up to the maximum
+// size in bytes.
+func NewLRUCache(name string, maxSize int64) *LRUCache {
+	return &LRUCache{
+		name:    name,
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get gets the value for the key, if it is cached for the version.
+func (c *LRUCache) Get(version, key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checkVersion(version)
+	if element, found := c.items[key]; found {
+		c.order.MoveToFront(element)
+		c.stats.Hits++
+		return element.Value.(*lruEntry).value, true
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+// Add caches the value for the key, with its approximate size in bytes.
+// Values larger than the whole cache are not cached.
+func (c *LRUCache) Add(version, key string, value interface{}, size int64) {
+	if c == nil || size > c.maxSize {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checkVersion(version)
+	if element, found := c.items[key]; found {
+		c.remove(element)
+	}
+	for c.size+size > c.maxSize {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key, value, size})
+	c.size += size
+}
+
+// Stats gets the statistics of the cache.
+func (c *LRUCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Name = c.name
+	stats.Entries = c.order.Len()
+	stats.Size = c.size
+	stats.MaxSize = c.maxSize
+	return stats
+}
+
+// checkVersion empties the cache when the version has changed.
+func (c *LRUCache) checkVersion(version string) {
+	if version != c.version {
+		c.items = make(map[string]*list.Element)
+		c.order.Init()
+		c.size = 0
+		c.version = version
+	}
+}
+
+func (c *LRUCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*lruEntry)
+	delete(c.items, entry.key)
+	c.size -= entry.size
+}
+
+// cacheSize estimates the memory held by a cached query result, with the
+// strings and slices of every zip code.
+func (q QueryResult) cacheSize() int64 {
+	size := int64(unsafe.Sizeof(q))
+	for _, entry := range q.ZipCodeEntries {
+		size += entry.cacheSize()
+	}
+	for _, facet := range q.Facets {
+		size += int64(unsafe.Sizeof(facet)) + int64(len(facet.Field))
+		for _, value := range facet.Values {
+			size += int64(unsafe.Sizeof(value)) + int64(len(value.Value))
+		}
+	}
+	return size
+}
+
+// cacheSize estimates the memory held by a zip code, counting the bytes of
+// each of its strings.
+func (z ZipEntry) cacheSize() int64 {
+	size := int64(unsafe.Sizeof(z))
+	for _, s := range []string{z.ZipCode, z.Type, z.City, z.County, z.State, z.StateName, z.Country, z.CountryName, z.TimeZone} {
+		size += int64(len(s))
+	}
+	for _, list := range [][]string{z.AcceptableCities, z.UnacceptableCities, z.AreaCodes} {
+		for _, s := range list {
+			size += int64(unsafe.Sizeof(s)) + int64(len(s))
+		}
+	}
+	return size
+}
+
+// CacheStats gets the statistics of the query and image caches.
+func (d *Database) CacheStats() []CacheStats {
+	return []CacheStats{d.queryCache.Stats(), d.imageCache.Stats()}
+}
@@ -0,0 +1,124 @@
+package zilch
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func Test_LRUCache(t *testing.T) {
+	c := NewLRUCache("test", 10)
+	c.Add("v1", "a", "A", 4)
+	c.Add("v1", "b", "B", 4)
+	if value, found := c.Get("v1", "a"); !found || value != "A" {
+		t.Errorf("Wrong value %v", value)
+	}
+
+	// b is the least recently used
+	c.Add("v1", "c", "C", 4)
+	if _, found := c.Get("v1", "b"); found {
+		t.Error("Expected b to be evicted")
+	}
+	if _, found := c.Get("v1", "a"); !found {
+		t.Error("Expected a to be cached")
+	}
+
+	// replacing a value frees its size, and values larger than the cache are
+	// not cached
+	c.Add("v1", "a", "AA", 6)
+	c.Add("v1", "d", "D", 11)
+	stats := c.Stats()
+	if stats != (CacheStats{"test", 2, 10, 10, 2, 1, 1}) {
+		t.Errorf("Wrong stats %v", stats)
+	}
+
+	// a new version empties the cache
+	if _, found := c.Get("v2", "a"); found {
+		t.Error("Unexpected value from an older version")
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Size != 0 {
+		t.Errorf("Wrong stats %v", stats)
+	}
+
+	var nilCache *LRUCache
+	nilCache.Add("v1", "a", "A", 1)
+	if _, found := nilCache.Get("v1", "a"); found {
+		t.Error("Unexpected value from a nil cache")
+	}
+}
+
+func Test_ExecQuery_Cache(t *testing.T) {
+	database := testRegionDatabase()
+	database.FullyLoaded = true
+	database.Version = "v1"
+	database.queryCache = NewLRUCache("queries", 1<<20)
+	for i := range database.CountryIndexMap["US"].Entries {
+		database.CountryIndexMap["US"].Entries[i].TimeZone = "America/New_York"
+	}
+
+	first, err := database.ExecQuery(map[string]string{"State": "VA", "Country": "US", "callback": "cb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := database.ExecQuery(map[string]string{"Country": "US", "State": "VA"})
+	if stats := database.queryCache.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || stats.Size == 0 {
+		t.Errorf("Wrong stats %v", stats)
+	}
+	if second.TotalFound != first.TotalFound || len(second.ZipCodeEntries) != 3 {
+		t.Errorf("Wrong cached result %v", second)
+	}
+
+	// the local times are not cached
+	withTime, _ := database.ExecQuery(map[string]string{"Country": "US", "State": "VA", "localtime": "true"})
+	third, _ := database.ExecQuery(map[string]string{"Country": "US", "State": "VA"})
+	if withTime.ZipCodeEntries[0].LocalTime == nil || third.ZipCodeEntries[0].LocalTime != nil {
+		t.Errorf("Wrong local times %v %v", withTime.ZipCodeEntries[0].LocalTime, third.ZipCodeEntries[0].LocalTime)
+	}
+
+	database.Version = "v2"
+	database.ExecQuery(map[string]string{"Country": "US", "State": "VA"})
+	if stats := database.queryCache.Stats(); stats.Hits != 3 || stats.Misses != 2 {
+		t.Errorf("Expected a miss after a reload %v", stats)
+	}
+}
+
+func Test_CacheStats_Marshal(t *testing.T) {
+	c := CacheStatsMarshaller{CacheStats{"queries", 2, 300, 1000, 5, 2, 0}}
+	expected := map[string]string{
+		"JSON": `[{"Name":"queries","Entries":2,"Size":300,"MaxSize":1000,"Hits":5,"Misses":2,"Evictions":0}]`,
+		"XML":  "<Caches><CacheStats><Name>queries</Name><Entries>2</Entries>",
+		"YAML": "  - Name:      queries\n    Entries:   2\n",
+	}
+	for format, part := range expected {
+		if data, err := c.Marshal(format); err != nil || !strings.Contains(data, part) {
+			t.Errorf("Wrong %s %v: %s", format, err, data)
+		}
+	}
+}
+
+func Test_QueryResult_CacheSize(t *testing.T) {
+	entry := ZipEntry{
+		ZipCode:          "22151",
+		Type:             "STANDARD",
+		City:             "Springfield",
+		AcceptableCities: []string{"North Springfield"},
+		County:           "Fairfax County",
+		State:            "VA",
+		StateName:        "Virginia",
+		Country:          "US",
+		CountryName:      "United States",
+		TimeZone:         "America/New_York",
+		AreaCodes:        []string{"703", "571"},
+	}
+	// 79 bytes in the strings, and 23 bytes in the 3 strings of the slices
+	expected := int64(unsafe.Sizeof(entry)) + 79 + 23 + 3*int64(unsafe.Sizeof(""))
+	if size := entry.cacheSize(); size != expected {
+		t.Errorf("Wrong size of the entry %v, expected %v", size, expected)
+	}
+
+	q := QueryResult{ZipCodeEntries: []ZipEntry{entry, entry}, Facets: []Facet{{"State", []FacetValue{{"VA", 2}}}}}
+	expected = int64(unsafe.Sizeof(q)) + 2*expected + int64(unsafe.Sizeof(Facet{})) + 5 + int64(unsafe.Sizeof(FacetValue{})) + 2
+	if size := q.cacheSize(); size != expected {
+		t.Errorf("Wrong size of the query result %v, expected %v", size, expected)
+	}
+}
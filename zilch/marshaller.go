@@ -2,168 +2,469 @@ package zilch
 
 import (
 	"bytes"
-	"encoding/json"
+	"encoding/csv"
 	"encoding/xml"
-	"errors"
 	"fmt"
 	"reflect"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
-// Marshal marshals the a DistributionEntry.
+// Marshal marshals the list of DistributionEntry objects.
 func (d DistributionMarshaller) Marshal(format string) (string, error) {
-	format = strings.ToUpper(format)
+	return marshal(format, d)
+}
+
+func (d DistributionMarshaller) toXML() (string, error) {
 	buf := bytes.Buffer{}
-	switch format {
-	case "JS":
-		enc := json.NewEncoder(&buf)
-		if err := enc.Encode(&d); err != nil {
-			return "", err
-		}
-		return buf.String(), nil
-	case "JSON":
-		enc := json.NewEncoder(&buf)
-		if err := enc.Encode(&d); err != nil {
-			return "", err
-		}
-		return buf.String(), nil
-	case "XML":
-		enc := xml.NewEncoder(&buf)
-		if err := enc.Encode(&d); err != nil {
-			return "", err
-		}
-		return "<?xml version=\"1.0\" encoding=\"UTF-8\"?><DistributionList>" + buf.String() + "</DistributionList>", nil
-	case "YAML":
-		buf.WriteString("DistributionEntries:\n")
-		for _, entry := range d {
-			buf.WriteString(fmt.Sprintf("  - ZipCodes:  %v\n", entry.ZipCodes))
-			buf.WriteString(fmt.Sprintf("    Latitude:  %v\n", entry.Latitude))
-			buf.WriteString(fmt.Sprintf("    Longitude: %v\n\n", entry.Longitude))
+	enc := xml.NewEncoder(&buf)
+	if err := enc.Encode(&d); err != nil {
+		return "", err
+	}
+	return "<?xml version=\"1.0\" encoding=\"UTF-8\"?><DistributionList>" + buf.String() + "</DistributionList>", nil
+}
+
+func (d DistributionMarshaller) toMsgPack() (string, error) {
+	return encodeMsgPack([]DistributionEntry(d))
+}
+
+func (d DistributionMarshaller) toGeoJSON() (string, error) {
+	features := make([]GeoJSONFeature, 0, len(d))
+	for _, entry := range d {
+		features = append(features, entry.toGeoJSON())
+	}
+	return newFeatureCollection(features).toJSON()
+}
+
+func (d DistributionMarshaller) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString("DistributionEntries:\n")
+	for _, entry := range d {
+		buf.WriteString(fmt.Sprintf("  - ZipCodes:  %v\n", entry.ZipCodes))
+		buf.WriteString(fmt.Sprintf("    Latitude:  %v\n", entry.Latitude))
+		buf.WriteString(fmt.Sprintf("    Longitude: %v\n", entry.Longitude))
+		if len(entry.Grid) > 0 {
+			buf.WriteString(fmt.Sprintf("    Resolution: %v\n", entry.Resolution))
+			buf.WriteString(fmt.Sprintf("    Grid:      %v\n", yamlScalar(entry.Grid)))
 		}
-		return buf.String(), nil
-	default:
-		return "", errors.New("Invalid format: " + format)
+		buf.WriteString("\n")
 	}
+	return buf.String(), nil
 }
 
 // Marshal marshals the a country-zipcodes map.
 func (c CountryMarshaller) Marshal(format string) (string, error) {
-	format = strings.ToUpper(format)
+	return marshal(format, c)
+}
+
+func (c CountryMarshaller) toXML() (string, error) {
 	buf := bytes.Buffer{}
-	switch format {
-	case "JS":
-		enc := json.NewEncoder(&buf)
-		if err := enc.Encode(&c); err != nil {
-			return "", err
+	buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?><Countries>")
+	for _, key := range c.countryCodes() {
+		buf.WriteString("<Country><Code>")
+		xml.EscapeText(&buf, []byte(key))
+		buf.WriteString(fmt.Sprintf("</Code><ZipCodes>%v</ZipCodes></Country>", c[key]))
+	}
+	buf.WriteString("</Countries>")
+	return buf.String(), nil
+}
+
+func (c CountryMarshaller) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	for _, key := range c.countryCodes() {
+		buf.WriteString(fmt.Sprintf("%v: %v\n", yamlScalar(key), c[key]))
+	}
+	return buf.String(), nil
+}
+
+func (c CountryMarshaller) countryCodes() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Marshal marshals the CountryEntry object.
+func (c CountryEntryMarshaller) Marshal(format string) (string, error) {
+	return marshal(format, c)
+}
+
+func (c CountryEntryMarshaller) toXML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Countries>`)
+	enc := xml.NewEncoder(&buf)
+	if err := enc.Encode(&c); err != nil {
+		return "", err
+	}
+	buf.WriteString("</Countries>")
+	return buf.String(), nil
+}
+
+func (c CountryEntryMarshaller) toMsgPack() (string, error) {
+	return encodeMsgPack([]CountryEntry(c))
+}
+
+func (c CountryEntryMarshaller) toGeoJSON() (string, error) {
+	features := make([]GeoJSONFeature, 0, len(c))
+	for _, ce := range c {
+		features = append(features, ce.toGeoJSON()...)
+	}
+	return newFeatureCollection(features).toJSON()
+}
+
+func (c CountryEntryMarshaller) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	for _, ce := range c {
+		buf.WriteString(fmt.Sprintf("  - Country:     %v\n", yamlScalar(ce.Country)))
+		buf.WriteString(fmt.Sprintf("    CountryName: %v\n", yamlScalar(ce.CountryName)))
+		buf.WriteString(fmt.Sprintf("    ZipCodes:    %v\n", ce.ZipCodes))
+		buf.WriteString(fmt.Sprintf("    Latitude:    %v\n", ce.Latitude))
+		buf.WriteString(fmt.Sprintf("    Longitude:   %v\n", ce.Longitude))
+		buf.WriteString(ce.Bounds.toYAML("    "))
+		buf.WriteString(fmt.Sprintf("    Coverage:    %v\n", ce.Coverage))
+		buf.WriteString("    States:\n")
+
+		for _, se := range ce.States {
+			buf.WriteString(fmt.Sprintf("      - State:     %v\n", yamlScalar(se.State)))
+			buf.WriteString(fmt.Sprintf("        StateName: %v\n", yamlScalar(se.StateName)))
+			buf.WriteString(fmt.Sprintf("        ZipCodes:  %v\n", se.ZipCodes))
+			buf.WriteString(fmt.Sprintf("        Latitude:  %v\n", se.Latitude))
+			buf.WriteString(fmt.Sprintf("        Longitude: %v\n", se.Longitude))
+			buf.WriteString(se.Bounds.toYAML("        "))
+			buf.WriteString(fmt.Sprintf("        Coverage:  %v\n\n", se.Coverage))
 		}
-		return buf.String(), nil
-	case "JSON":
-		enc := json.NewEncoder(&buf)
-		if err := enc.Encode(&c); err != nil {
+	}
+	return buf.String(), nil
+}
+
+// Marshal marshals the list of Suggestion objects.
+func (s SuggestionMarshaller) Marshal(format string) (string, error) {
+	return marshal(format, s)
+}
+
+func (s SuggestionMarshaller) toXML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Suggestions>`)
+	for _, suggestion := range s {
+		buf.WriteString("<Suggestion><Text>")
+		xml.EscapeText(&buf, []byte(suggestion.Text))
+		buf.WriteString("</Text><Type>")
+		xml.EscapeText(&buf, []byte(suggestion.Type))
+		buf.WriteString(fmt.Sprintf("</Type><ZipCodes>%v</ZipCodes>", suggestion.ZipCodes))
+		entry, err := suggestion.Entry.toXML()
+		if err != nil {
 			return "", err
 		}
-		return buf.String(), nil
-	case "XML":
-		buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?><Countries>")
-		for key, val := range map[string]int(c) {
-			buf.WriteString(fmt.Sprintf("<%v>%v</%v>", key, val, key))
+		buf.WriteString(entry)
+		buf.WriteString("</Suggestion>")
+	}
+	buf.WriteString("</Suggestions>")
+	return buf.String(), nil
+}
+
+func (s SuggestionMarshaller) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString("Suggestions:\n")
+	for _, suggestion := range s {
+		buf.WriteString(fmt.Sprintf("  - Text:      %v\n", yamlScalar(suggestion.Text)))
+		buf.WriteString(fmt.Sprintf("    Type:      %v\n", yamlScalar(suggestion.Type)))
+		buf.WriteString(fmt.Sprintf("    ZipCodes:  %v\n", suggestion.ZipCodes))
+		buf.WriteString("    Entry:\n")
+		suggestion.Entry.writeYAML(&buf, "        ", "        ")
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// Marshal marshals the list of BatchResult objects.
+func (b BatchResultMarshaller) Marshal(format string) (string, error) {
+	return marshal(format, b)
+}
+
+func (b BatchResultMarshaller) toXML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><BatchResults>`)
+	for _, result := range b {
+		buf.WriteString("<BatchResult><Country>")
+		xml.EscapeText(&buf, []byte(result.Country))
+		buf.WriteString("</Country><ZipCode>")
+		xml.EscapeText(&buf, []byte(result.ZipCode))
+		buf.WriteString(fmt.Sprintf("</ZipCode><Found>%v</Found><PartialMatch>%v</PartialMatch><ZipCodeEntries>", result.Found, result.PartialMatch))
+		for _, entry := range result.ZipCodeEntries {
+			xml, err := entry.toXML()
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(xml)
+		}
+		buf.WriteString("</ZipCodeEntries></BatchResult>")
+	}
+	buf.WriteString("</BatchResults>")
+	return buf.String(), nil
+}
+
+func (b BatchResultMarshaller) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString("BatchResults:\n")
+	for _, result := range b {
+		buf.WriteString(fmt.Sprintf("  - Country:        %v\n", yamlScalar(result.Country)))
+		buf.WriteString(fmt.Sprintf("    ZipCode:        %v\n", yamlScalar(result.ZipCode)))
+		buf.WriteString(fmt.Sprintf("    Found:          %v\n", result.Found))
+		buf.WriteString(fmt.Sprintf("    PartialMatch:   %v\n", result.PartialMatch))
+		if len(result.ZipCodeEntries) == 0 {
+			buf.WriteString("    ZipCodeEntries: []\n\n")
+			continue
 		}
-		buf.WriteString("</Countries>")
-		return buf.String(), nil
-	case "YAML":
-		for key, val := range map[string]int(c) {
-			buf.WriteString(fmt.Sprintf("%v: %v\n", key, val))
+		buf.WriteString("    ZipCodeEntries:\n")
+		for _, entry := range result.ZipCodeEntries {
+			entry.writeYAML(&buf, "        ", "      - ")
 		}
-		return buf.String(), nil
-	default:
-		return "", errors.New("Invalid format: " + format)
+		buf.WriteString("\n")
 	}
+	return buf.String(), nil
 }
 
-// Marshal marshals the CountryEntry object.
-func (c CountryEntryMarshaller) Marshal(format string) (string, error) {
-	format = strings.ToUpper(format)
+// Marshal marshals the AddressValidation object.
+func (v AddressValidation) Marshal(format string) (string, error) {
+	return marshal(format, v)
+}
+
+func (v AddressValidation) toXML() (string, error) {
+	return encodeXMLDocument(&v)
+}
+
+func (v AddressValidation) toYAML() (string, error) {
 	buf := bytes.Buffer{}
-	switch format {
-	case "JS":
-		enc := json.NewEncoder(&buf)
-		if err := enc.Encode(&c); err != nil {
-			return "", err
+	buf.WriteString(fmt.Sprintf("ZipCode:      %v\n", yamlScalar(v.ZipCode)))
+	buf.WriteString(fmt.Sprintf("City:         %v\n", yamlScalar(v.City)))
+	buf.WriteString(fmt.Sprintf("State:        %v\n", yamlScalar(v.State)))
+	buf.WriteString(fmt.Sprintf("Country:      %v\n", yamlScalar(v.Country)))
+	buf.WriteString(fmt.Sprintf("Valid:        %v\n", v.Valid))
+	buf.WriteString(fmt.Sprintf("ZipCodeFound: %v\n", v.ZipCodeFound))
+	buf.WriteString(fmt.Sprintf("PartialMatch: %v\n", v.PartialMatch))
+	buf.WriteString(fmt.Sprintf("CityStatus:   %v\n", yamlScalar(v.CityStatus)))
+	buf.WriteString(fmt.Sprintf("StateMatches: %v\n\n", v.StateMatches))
+	if len(v.Corrections) == 0 {
+		buf.WriteString("Corrections: []\n")
+	} else {
+		buf.WriteString("Corrections:\n")
+		for _, c := range v.Corrections {
+			buf.WriteString(fmt.Sprintf("  - ZipCode: %v\n", yamlScalar(c.ZipCode)))
+			buf.WriteString(fmt.Sprintf("    City:    %v\n", yamlScalar(c.City)))
+			buf.WriteString(fmt.Sprintf("    State:   %v\n", yamlScalar(c.State)))
+			buf.WriteString(fmt.Sprintf("    Country: %v\n", yamlScalar(c.Country)))
+			buf.WriteString(fmt.Sprintf("    Score:   %v\n\n", c.Score))
 		}
-	case "JSON":
-		enc := json.NewEncoder(&buf)
-		if err := enc.Encode(&c); err != nil {
-			return "", err
+	}
+	return buf.String(), nil
+}
+
+// Marshal marshals the FormatValidation object.
+func (v FormatValidation) Marshal(format string) (string, error) {
+	return marshal(format, v)
+}
+
+func (v FormatValidation) toXML() (string, error) {
+	return encodeXMLDocument(&v)
+}
+
+func (v FormatValidation) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("ZipCode: %v\n", yamlScalar(v.ZipCode)))
+	buf.WriteString(fmt.Sprintf("Country: %v\n", yamlScalar(v.Country)))
+	buf.WriteString(fmt.Sprintf("Valid:   %v\n", v.Valid))
+	buf.WriteString(fmt.Sprintf("Reason:  %v\n", yamlScalar(v.Reason)))
+	buf.WriteString("Format:\n")
+	buf.WriteString(fmt.Sprintf("  Country:           %v\n", yamlScalar(v.Format.Country)))
+	buf.WriteString(fmt.Sprintf("  Pattern:           %v\n", yamlScalar(v.Format.Pattern)))
+	buf.WriteString(fmt.Sprintf("  MinLength:         %v\n", v.Format.MinLength))
+	buf.WriteString(fmt.Sprintf("  MaxLength:         %v\n", v.Format.MaxLength))
+	buf.WriteString(fmt.Sprintf("  AllowedCharacters: %v\n", yamlScalar(v.Format.AllowedCharacters)))
+	buf.WriteString(fmt.Sprintf("  Example:           %v\n", yamlScalar(v.Format.Example)))
+	return buf.String(), nil
+}
+
+// Marshal marshals the NormalizedPostalCode object.
+func (n NormalizedPostalCode) Marshal(format string) (string, error) {
+	return marshal(format, n)
+}
+
+func (n NormalizedPostalCode) toXML() (string, error) {
+	return encodeXMLDocument(&n)
+}
+
+func (n NormalizedPostalCode) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("ZipCode:    %v\n", yamlScalar(n.ZipCode)))
+	buf.WriteString(fmt.Sprintf("Country:    %v\n", yamlScalar(n.Country)))
+	buf.WriteString(fmt.Sprintf("Normalized: %v\n", yamlScalar(n.Normalized)))
+	return buf.String(), nil
+}
+
+// Marshal marshals the Region object.
+func (r Region) Marshal(format string) (string, error) {
+	return marshal(format, r)
+}
+
+func (r Region) toXML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	if err := r.writeXML(&buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (r Region) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	if err := r.writeYAML(&buf, "", ""); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Marshal marshals the list of CacheStats objects.
+func (c CacheStatsMarshaller) Marshal(format string) (string, error) {
+	return marshal(format, c)
+}
+
+func (c CacheStatsMarshaller) toXML() (string, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Caches>`)
+	enc := xml.NewEncoder(&buf)
+	if err := enc.Encode(&c); err != nil {
+		return "", err
+	}
+	buf.WriteString("</Caches>")
+	return buf.String(), nil
+}
+
+func (c CacheStatsMarshaller) toYAML() (string, error) {
+	buf := bytes.Buffer{}
+	for _, stats := range c {
+		buf.WriteString(fmt.Sprintf("  - Name:      %v\n", yamlScalar(stats.Name)))
+		buf.WriteString(fmt.Sprintf("    Entries:   %v\n", stats.Entries))
+		buf.WriteString(fmt.Sprintf("    Size:      %v\n", stats.Size))
+		buf.WriteString(fmt.Sprintf("    MaxSize:   %v\n", stats.MaxSize))
+		buf.WriteString(fmt.Sprintf("    Hits:      %v\n", stats.Hits))
+		buf.WriteString(fmt.Sprintf("    Misses:    %v\n", stats.Misses))
+		buf.WriteString(fmt.Sprintf("    Evictions: %v\n\n", stats.Evictions))
+	}
+	return buf.String(), nil
+}
+
+func (r Region) writeXML(buf *bytes.Buffer) error {
+	writetag := func(name, value string) {
+		buf.WriteString("<" + name + ">")
+		xml.EscapeText(buf, []byte(value))
+		buf.WriteString("</" + name + ">")
+	}
+
+	buf.WriteString("<Region>")
+	writetag("Type", r.Type)
+	writetag("Code", r.Code)
+	writetag("Name", r.Name)
+	writetag("ZipCodes", strconv.FormatUint(uint64(r.ZipCodes), 10))
+	writetag("Latitude", strconv.FormatFloat(float64(r.Latitude), 'f', -1, 32))
+	writetag("Longitude", strconv.FormatFloat(float64(r.Longitude), 'f', -1, 32))
+	buf.WriteString("<Bounds>")
+	writetag("North", strconv.FormatFloat(float64(r.Bounds.North), 'f', -1, 32))
+	writetag("West", strconv.FormatFloat(float64(r.Bounds.West), 'f', -1, 32))
+	writetag("South", strconv.FormatFloat(float64(r.Bounds.South), 'f', -1, 32))
+	writetag("East", strconv.FormatFloat(float64(r.Bounds.East), 'f', -1, 32))
+	buf.WriteString("</Bounds>")
+	writetag("Coverage", strconv.FormatFloat(float64(r.Coverage), 'f', -1, 32))
+	buf.WriteString("<Links>")
+	for _, link := range r.Links {
+		buf.WriteString("<Link>")
+		writetag("Rel", link.Rel)
+		writetag("Href", link.Href)
+		buf.WriteString("</Link>")
+	}
+	buf.WriteString("</Links>")
+	if len(r.Children) > 0 {
+		buf.WriteString("<Children>")
+		for _, child := range r.Children {
+			if err := child.writeXML(buf); err != nil {
+				return err
+			}
 		}
-	case "XML":
-		buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Countries>`)
-		enc := xml.NewEncoder(&buf)
-		if err := enc.Encode(&c); err != nil {
-			return "", err
+		buf.WriteString("</Children>")
+	}
+	if len(r.ZipCodeEntries) > 0 {
+		buf.WriteString("<ZipCodeEntries>")
+		for _, entry := range r.ZipCodeEntries {
+			xml, err := entry.toXML()
+			if err != nil {
+				return err
+			}
+			buf.WriteString(xml)
 		}
-		buf.WriteString("</Countries>")
-	case "YAML":
-		for _, ce := range c {
-			buf.WriteString(fmt.Sprintf("  - Country:     %v\n", ce.Country))
-			buf.WriteString(fmt.Sprintf("    CountryName: %v\n", ce.CountryName))
-			buf.WriteString("    States:\n")
-
-			for _, se := range ce.States {
-				buf.WriteString(fmt.Sprintf("      - State:     %v\n", se.State))
-				buf.WriteString(fmt.Sprintf("        StateName: %v\n", se.StateName))
-				buf.WriteString(fmt.Sprintf("        ZipCodes:  %v\n\n", se.ZipCodes))
+		buf.WriteString("</ZipCodeEntries>")
+	}
+	buf.WriteString("</Region>")
+	return nil
+}
+
+// writeYAML writes the region with each line indented, except for the first
+// line which starts with the listIndent when the region is a list item.
+func (r Region) writeYAML(buf *bytes.Buffer, indent, listIndent string) error {
+	buf.WriteString(fmt.Sprintf("%vType:      %v\n", listIndent, yamlScalar(r.Type)))
+	buf.WriteString(fmt.Sprintf("%vCode:      %v\n", indent, yamlScalar(r.Code)))
+	buf.WriteString(fmt.Sprintf("%vName:      %v\n", indent, yamlScalar(r.Name)))
+	buf.WriteString(fmt.Sprintf("%vZipCodes:  %v\n", indent, r.ZipCodes))
+	buf.WriteString(fmt.Sprintf("%vLatitude:  %v\n", indent, r.Latitude))
+	buf.WriteString(fmt.Sprintf("%vLongitude: %v\n", indent, r.Longitude))
+	buf.WriteString(r.Bounds.toYAML(indent))
+	buf.WriteString(fmt.Sprintf("%vCoverage:  %v\n", indent, r.Coverage))
+	buf.WriteString(fmt.Sprintf("%vLinks:\n", indent))
+	for _, link := range r.Links {
+		buf.WriteString(fmt.Sprintf("%v  - Rel:  %v\n", indent, yamlScalar(link.Rel)))
+		buf.WriteString(fmt.Sprintf("%v    Href: %v\n", indent, yamlScalar(link.Href)))
+	}
+	if len(r.Children) > 0 {
+		buf.WriteString(fmt.Sprintf("%vChildren:\n", indent))
+		for _, child := range r.Children {
+			if err := child.writeYAML(buf, indent+"    ", indent+"  - "); err != nil {
+				return err
 			}
 		}
-	default:
-		return "", errors.New("Invalid format: " + format)
 	}
-	return buf.String(), nil
+	if len(r.ZipCodeEntries) > 0 {
+		buf.WriteString(fmt.Sprintf("%vZipCodeEntries:\n", indent))
+		for _, entry := range r.ZipCodeEntries {
+			entry.writeYAML(buf, indent+"    ", indent+"  - ")
+		}
+	}
+	return nil
+}
+
+func (b BoundingBox) toYAML(indent string) string {
+	return fmt.Sprintf("%vBounds:\n%v  North: %v\n%v  West:  %v\n%v  South: %v\n%v  East:  %v\n",
+		indent, indent, b.North, indent, b.West, indent, b.South, indent, b.East)
 }
 
 // Marshal marshals the ZipEntry object.
 func (z ZipEntry) Marshal(format string) (string, error) {
-	format = strings.ToUpper(format)
-	switch format {
-	case "XML":
-		return z.toXML()
-	case "JS":
-		return z.toJSON()
-	case "JSON":
-		return z.toJSON()
-	case "YAML":
-		return z.toYAML()
-	default:
-		return "", errors.New("Invalid format: " + format)
-	}
+	return marshal(format, z)
 }
 
 // Marshal marshals the QueryResult object.
 func (q QueryResult) Marshal(format string) (string, error) {
-	format = strings.ToUpper(format)
-	switch format {
-	case "XML":
-		return q.toXML()
-	case "JS":
-		return q.toJSON()
-	case "JSON":
-		return q.toJSON()
-	case "YAML":
-		return q.toYAML()
-	default:
-		return "", errors.New("Invalid format: " + format)
-	}
+	return marshal(format, q)
 }
 
 func (q QueryResult) toJSON() (string, error) {
-	buf := bytes.Buffer{}
-	enc := json.NewEncoder(&buf)
-	r := regexp.MustCompile("\\s+$")
-	if err := enc.Encode(&q); err != nil {
-		return "", err
-	}
-	return r.ReplaceAllString(buf.String(), ""), nil
+	js, err := encodeJSON(&q)
+	return strings.TrimRight(js, "\n"), err
+}
+
+func (q QueryResult) toMsgPack() (string, error) {
+	return encodeMsgPack(q)
 }
 
 func (q QueryResult) toXML() (string, error) {
@@ -173,6 +474,14 @@ func (q QueryResult) toXML() (string, error) {
 	buf.WriteString(fmt.Sprintf("<TotalFound>%v</TotalFound>", q.TotalFound))
 	buf.WriteString(fmt.Sprintf("<StartIndex>%v</StartIndex>", q.StartIndex))
 	buf.WriteString(fmt.Sprintf("<EndIndex>%v</EndIndex>", q.EndIndex))
+	if len(q.Facets) > 0 {
+		buf.WriteString("<Facets>")
+		enc := xml.NewEncoder(&buf)
+		if err := enc.Encode(q.Facets); err != nil {
+			return "", err
+		}
+		buf.WriteString("</Facets>")
+	}
 	buf.WriteString("<ZipCodeEntries>")
 	for _, entry := range q.ZipCodeEntries {
 		xml, err := entry.toXML()
@@ -186,12 +495,76 @@ func (q QueryResult) toXML() (string, error) {
 	return buf.String(), nil
 }
 
+// delimitedColumns are the columns written to CSV and TSV files, in the
+// layout read by the ZipEntryReader.
+var delimitedColumns = []string{
+	zipCodeCol, typeCol, cityCol, acceptableCitiesCol, unacceptableCitiesCol, countyCol, stateCol,
+	stateNameCol, countryCol, countryNameCol, timezoneCol, areaCodesCol, latitudeCol, longitudeCol,
+}
+
+func (q QueryResult) toDelimited(delimiter rune) (string, error) {
+	buf := bytes.Buffer{}
+	w := csv.NewWriter(&buf)
+	w.Comma = delimiter
+	w.Write(delimitedColumns)
+	for _, entry := range q.ZipCodeEntries {
+		w.Write(entry.toRecord())
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// toRecord converts the zip entry into a row of delimitedColumns. Lists are
+// joined the same way the reader splits them, and zip codes without
+// coordinates have empty latitude and longitude columns.
+func (z ZipEntry) toRecord() []string {
+	latitude, longitude := "", ""
+	if z.Latitude != 0 || z.Longitude != 0 {
+		latitude = strconv.FormatFloat(float64(z.Latitude), 'f', -1, 32)
+		longitude = strconv.FormatFloat(float64(z.Longitude), 'f', -1, 32)
+	}
+	return []string{
+		z.ZipCode, z.Type, z.City, strings.Join(z.AcceptableCities, ", "), strings.Join(z.UnacceptableCities, ", "),
+		z.County, z.State, z.StateName, z.Country, z.CountryName, z.TimeZone, strings.Join(z.AreaCodes, ", "),
+		latitude, longitude,
+	}
+}
+
+// exportFileName is the name of a CSV or TSV download. Results from a single
+// country are named like the files in the resources directory, so that the
+// download can be loaded as a resource.
+func (q QueryResult) exportFileName(extension string) string {
+	country := ""
+	for _, entry := range q.ZipCodeEntries {
+		if len(country) > 0 && entry.Country != country {
+			return "zip_codes." + extension
+		}
+		country = entry.Country
+	}
+	if len(country) == 0 {
+		return "zip_codes." + extension
+	}
+	return strings.ToLower(country) + "_zip_code_database." + extension
+}
+
 func (q QueryResult) toYAML() (string, error) {
 	buf := bytes.Buffer{}
 	buf.WriteString(fmt.Sprintf("ResultsReturned: %v\n", q.ResultsReturned))
 	buf.WriteString(fmt.Sprintf("TotalFound:      %v\n", q.TotalFound))
 	buf.WriteString(fmt.Sprintf("StartIndex:      %v\n", q.StartIndex))
 	buf.WriteString(fmt.Sprintf("EndIndex:        %v\n\n", q.EndIndex))
+	if len(q.Facets) > 0 {
+		buf.WriteString("Facets:\n")
+		for _, facet := range q.Facets {
+			buf.WriteString(fmt.Sprintf("  - Field:  %v\n", yamlScalar(facet.Field)))
+			buf.WriteString("    Values:\n")
+			for _, value := range facet.Values {
+				buf.WriteString(fmt.Sprintf("      - Value: %v\n", yamlScalar(value.Value)))
+				buf.WriteString(fmt.Sprintf("        Count: %v\n", value.Count))
+			}
+		}
+		buf.WriteString("\n")
+	}
 	buf.WriteString("ZipCodeEntries:\n")
 
 	for _, entry := range q.ZipCodeEntries {
@@ -205,27 +578,33 @@ func (q QueryResult) toYAML() (string, error) {
 }
 
 func (z ZipEntry) toJSON() (string, error) {
-	buf := bytes.Buffer{}
-	enc := json.NewEncoder(&buf)
-	r := regexp.MustCompile("\\s+$")
-	if err := enc.Encode(&z); err != nil {
-		return "", err
-	}
-	return r.ReplaceAllString(buf.String(), ""), nil
+	js, err := encodeJSON(&z)
+	return strings.TrimRight(js, "\n"), err
 }
 
 func (z ZipEntry) toYAML() (string, error) {
 	buf := bytes.Buffer{}
+	z.writeYAML(&buf, "    ", "  - ")
+	buf.WriteString("\n")
+	return buf.String(), nil
+}
+
+// writeYAML writes the zip entry with each line indented, except for the
+// first line which starts with the listIndent when the entry is a list item.
+func (z ZipEntry) writeYAML(buf *bytes.Buffer, indent, listIndent string) {
 	zval := reflect.ValueOf(z)
 	for i := 0; i < zval.NumField(); i++ {
 		valField := zval.Field(i)
 		typeField := zval.Type().Field(i)
 		f := valField.Interface()
 		val := reflect.ValueOf(f)
+		if val.Kind() == reflect.Ptr && val.IsNil() {
+			continue
+		}
 		if i == 0 {
-			buf.WriteString("  - ")
+			buf.WriteString(listIndent)
 		} else {
-			buf.WriteString("    ")
+			buf.WriteString(indent)
 		}
 		buf.WriteString(fmt.Sprintf("%s:", typeField.Name))
 		for j := 0; j < (20 - len(typeField.Name)); j++ {
@@ -233,7 +612,7 @@ func (z ZipEntry) toYAML() (string, error) {
 		}
 		switch val.Kind() {
 		case reflect.String:
-			buf.WriteString(val.String())
+			buf.WriteString(yamlScalar(val.String()))
 		case reflect.Float32:
 			buf.WriteString(strconv.FormatFloat(val.Float(), 'f', -1, 32))
 		case reflect.Slice:
@@ -242,31 +621,32 @@ func (z ZipEntry) toYAML() (string, error) {
 				if j != 0 {
 					buf.WriteString(", ")
 				}
-				buf.WriteString(fmt.Sprintf("%s", val.Index(j)))
+				buf.WriteString(yamlScalar(val.Index(j).String()))
 			}
 			buf.WriteString("]")
+		case reflect.Ptr:
+			if lt, ok := f.(*LocalTimeInfo); ok {
+				buf.WriteString("\n")
+				buf.WriteString(fmt.Sprintf("%v  UTCOffset:        %v\n", indent, yamlScalar(lt.UTCOffset)))
+				buf.WriteString(fmt.Sprintf("%v  UTCOffsetSeconds: %v\n", indent, lt.UTCOffsetSeconds))
+				buf.WriteString(fmt.Sprintf("%v  DST:              %v\n", indent, lt.DST))
+				buf.WriteString(fmt.Sprintf("%v  LocalTime:        %v", indent, yamlScalar(lt.LocalTime)))
+			}
 		}
 		buf.WriteString("\n")
 	}
-	buf.WriteString("\n")
-	return buf.String(), nil
 }
 
 func (z ZipEntry) toXML() (string, error) {
 	buf := bytes.Buffer{}
 
-	strtoxml := func(text string) string {
-		if strings.Index(text, "&") != -1 {
-			return fmt.Sprintf("<![CDATA[%v]]>", text)
-		}
-		return text
-	}
-
 	writetag := func(name, value string) {
 		if len(value) == 0 {
 			buf.WriteString(fmt.Sprintf("<%v/>", name))
 		} else {
-			buf.WriteString(fmt.Sprintf("<%v>%v</%v>", name, strtoxml(value), name))
+			buf.WriteString(fmt.Sprintf("<%v>", name))
+			xml.EscapeText(&buf, []byte(value))
+			buf.WriteString(fmt.Sprintf("</%v>", name))
 		}
 	}
 
@@ -279,6 +659,9 @@ func (z ZipEntry) toXML() (string, error) {
 		f := valField.Interface()
 		val := reflect.ValueOf(f)
 		tagname := typeField.Name
+		if val.Kind() == reflect.Ptr && val.IsNil() {
+			continue
+		}
 		switch val.Kind() {
 		case reflect.String:
 			writetag(tagname, val.String())
@@ -298,6 +681,15 @@ func (z ZipEntry) toXML() (string, error) {
 				}
 				buf.WriteString(fmt.Sprintf("</%v>", tagname))
 			}
+		case reflect.Ptr:
+			if lt, ok := f.(*LocalTimeInfo); ok {
+				buf.WriteString(fmt.Sprintf("<%v>", tagname))
+				writetag("UTCOffset", lt.UTCOffset)
+				writetag("UTCOffsetSeconds", strconv.Itoa(lt.UTCOffsetSeconds))
+				writetag("DST", strconv.FormatBool(lt.DST))
+				writetag("LocalTime", lt.LocalTime)
+				buf.WriteString(fmt.Sprintf("</%v>", tagname))
+			}
 		}
 	}
 
@@ -305,3 +697,28 @@ func (z ZipEntry) toXML() (string, error) {
 
 	return buf.String(), nil
 }
+
+var yamlReservedWords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true, "~": true,
+}
+
+// yamlScalar writes a string as a YAML scalar. Strings are left unquoted
+// when they can only be read back as the same string, otherwise they are
+// double quoted. Numbers, booleans, nulls, indicator characters and empty
+// strings are all quoted, as is anything which would break a flow sequence.
+func yamlScalar(s string) string {
+	if len(s) == 0 || yamlReservedWords[strings.ToLower(s)] ||
+		strings.TrimSpace(s) != s ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`+.0123456789") ||
+		strings.ContainsAny(s, ",[]{}\"\\") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
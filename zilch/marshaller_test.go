@@ -1,6 +1,10 @@
 package zilch
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -10,11 +14,20 @@ func Test_Marshal_Countries_JSON(t *testing.T) {
 		CountryEntry{
 			Country:     "US",
 			CountryName: "United States of America",
+			ZipCodes:    uint32(421),
+			Latitude:    float32(39.5),
+			Longitude:   float32(-77.25),
+			Bounds:      BoundingBox{42.25, -83.5, 36.5, -75},
+			Coverage:    float32(0.5),
 			States: []StateEntry{
 				StateEntry{
 					State:     "VA",
 					StateName: "Virginia",
 					ZipCodes:  uint32(100),
+					Latitude:  float32(37.75),
+					Longitude: float32(-78.5),
+					Bounds:    BoundingBox{39.5, -83.5, 36.5, -75.25},
+					Coverage:  float32(1),
 				},
 				StateEntry{
 					State:     "PA",
@@ -25,7 +38,7 @@ func Test_Marshal_Countries_JSON(t *testing.T) {
 		},
 	}
 
-	test := `[{"Country":"US","CountryName":"United States of America","States":[{"State":"VA","StateName":"Virginia","ZipCodes":100},{"State":"PA","StateName":"Pennsylvania","ZipCodes":321}]}]`
+	test := `[{"Country":"US","CountryName":"United States of America","ZipCodes":421,"Latitude":39.5,"Longitude":-77.25,"Bounds":{"North":42.25,"West":-83.5,"South":36.5,"East":-75},"Coverage":0.5,"States":[{"State":"VA","StateName":"Virginia","ZipCodes":100,"Latitude":37.75,"Longitude":-78.5,"Bounds":{"North":39.5,"West":-83.5,"South":36.5,"East":-75.25},"Coverage":1},{"State":"PA","StateName":"Pennsylvania","ZipCodes":321,"Latitude":0,"Longitude":0,"Bounds":{"North":0,"West":0,"South":0,"East":0},"Coverage":0}]}]`
 
 	if data, err := CountryEntryMarshaller(entries).Marshal("JSON"); err != nil {
 		t.Error(err)
@@ -41,11 +54,20 @@ func Test_Marshal_Countries_XML(t *testing.T) {
 		CountryEntry{
 			Country:     "US",
 			CountryName: "United States of America",
+			ZipCodes:    uint32(421),
+			Latitude:    float32(39.5),
+			Longitude:   float32(-77.25),
+			Bounds:      BoundingBox{42.25, -83.5, 36.5, -75},
+			Coverage:    float32(0.5),
 			States: []StateEntry{
 				StateEntry{
 					State:     "VA",
 					StateName: "Virginia",
 					ZipCodes:  uint32(100),
+					Latitude:  float32(37.75),
+					Longitude: float32(-78.5),
+					Bounds:    BoundingBox{39.5, -83.5, 36.5, -75.25},
+					Coverage:  float32(1),
 				},
 				StateEntry{
 					State:     "PA",
@@ -56,7 +78,7 @@ func Test_Marshal_Countries_XML(t *testing.T) {
 		},
 	}
 
-	test := `<?xml version="1.0" encoding="UTF-8"?><Countries><CountryEntry><Country>US</Country><CountryName>United States of America</CountryName><States><State>VA</State><StateName>Virginia</StateName><ZipCodes>100</ZipCodes></States><States><State>PA</State><StateName>Pennsylvania</StateName><ZipCodes>321</ZipCodes></States></CountryEntry></Countries>`
+	test := `<?xml version="1.0" encoding="UTF-8"?><Countries><CountryEntry><Country>US</Country><CountryName>United States of America</CountryName><ZipCodes>421</ZipCodes><Latitude>39.5</Latitude><Longitude>-77.25</Longitude><Bounds><North>42.25</North><West>-83.5</West><South>36.5</South><East>-75</East></Bounds><Coverage>0.5</Coverage><States><State>VA</State><StateName>Virginia</StateName><ZipCodes>100</ZipCodes><Latitude>37.75</Latitude><Longitude>-78.5</Longitude><Bounds><North>39.5</North><West>-83.5</West><South>36.5</South><East>-75.25</East></Bounds><Coverage>1</Coverage></States><States><State>PA</State><StateName>Pennsylvania</StateName><ZipCodes>321</ZipCodes><Latitude>0</Latitude><Longitude>0</Longitude><Bounds><North>0</North><West>0</West><South>0</South><East>0</East></Bounds><Coverage>0</Coverage></States></CountryEntry></Countries>`
 
 	if data, err := CountryEntryMarshaller(entries).Marshal("XML"); err != nil {
 		t.Error(err)
@@ -72,11 +94,20 @@ func Test_Marshal_Countries_YAML(t *testing.T) {
 		CountryEntry{
 			Country:     "US",
 			CountryName: "United States of America",
+			ZipCodes:    uint32(421),
+			Latitude:    float32(39.5),
+			Longitude:   float32(-77.25),
+			Bounds:      BoundingBox{42.25, -83.5, 36.5, -75},
+			Coverage:    float32(0.5),
 			States: []StateEntry{
 				StateEntry{
 					State:     "VA",
 					StateName: "Virginia",
 					ZipCodes:  uint32(100),
+					Latitude:  float32(37.75),
+					Longitude: float32(-78.5),
+					Bounds:    BoundingBox{39.5, -83.5, 36.5, -75.25},
+					Coverage:  float32(1),
 				},
 				StateEntry{
 					State:     "PA",
@@ -89,14 +120,39 @@ func Test_Marshal_Countries_YAML(t *testing.T) {
 
 	test := `  - Country:     US
     CountryName: United States of America
+    ZipCodes:    421
+    Latitude:    39.5
+    Longitude:   -77.25
+    Bounds:
+      North: 42.25
+      West:  -83.5
+      South: 36.5
+      East:  -75
+    Coverage:    0.5
     States:
       - State:     VA
         StateName: Virginia
         ZipCodes:  100
+        Latitude:  37.75
+        Longitude: -78.5
+        Bounds:
+          North: 39.5
+          West:  -83.5
+          South: 36.5
+          East:  -75.25
+        Coverage:  1
 
       - State:     PA
         StateName: Pennsylvania
         ZipCodes:  321
+        Latitude:  0
+        Longitude: 0
+        Bounds:
+          North: 0
+          West:  0
+          South: 0
+          East:  0
+        Coverage:  0
 
 `
 
@@ -223,7 +279,7 @@ StartIndex:      1
 EndIndex:        1
 
 ZipCodeEntries:
-  - ZipCode:             22151
+  - ZipCode:             "22151"
     Type:                STANDARD
     City:                Springfield
     AcceptableCities:    [N Springfield, North Springfield]
@@ -234,7 +290,7 @@ ZipCodeEntries:
     Country:             US
     CountryName:         United States of America
     TimeZone:            America/New_York
-    AreaCodes:           [703, 202]
+    AreaCodes:           ["703", "202"]
     Latitude:            38.78
     Longitude:           -77.17
 
@@ -331,7 +387,7 @@ func Test_Marshal_YAML(t *testing.T) {
 		Longitude:          float32(-77.17),
 	}
 
-	text := `  - ZipCode:             22151
+	text := `  - ZipCode:             "22151"
     Type:                STANDARD
     City:                Springfield
     AcceptableCities:    [N Springfield, North Springfield]
@@ -342,7 +398,7 @@ func Test_Marshal_YAML(t *testing.T) {
     Country:             US
     CountryName:         United States of America
     TimeZone:            America/New_York
-    AreaCodes:           [703, 202]
+    AreaCodes:           ["703", "202"]
     Latitude:            38.78
     Longitude:           -77.17
 
@@ -416,3 +472,91 @@ func Test_Marshal_Invalid(t *testing.T) {
 		t.Error("Wrong exception:", err.Error())
 	}
 }
+
+func Test_Marshal_Results_CSV(t *testing.T) {
+	entries := []ZipEntry{
+		ZipEntry{
+			ZipCode:            "22151",
+			Type:               "STANDARD",
+			City:               "Springfield",
+			AcceptableCities:   []string{"N Springfield", "North Springfield"},
+			UnacceptableCities: []string{"N Springfld"},
+			County:             "Fairfax County",
+			State:              "VA",
+			StateName:          "Virginia",
+			Country:            "US",
+			CountryName:        "United States of America",
+			TimeZone:           "America/New_York",
+			AreaCodes:          []string{"703", "202"},
+			Latitude:           float32(38.78),
+			Longitude:          float32(-77.17),
+		},
+		ZipEntry{
+			ZipCode:            "22152",
+			Type:               "PO BOX",
+			City:               "Springfield",
+			AcceptableCities:   []string{},
+			UnacceptableCities: []string{},
+			County:             "Fairfax \"The County\"",
+			State:              "VA",
+			StateName:          "Virginia",
+			Country:            "US",
+			CountryName:        "United States of America",
+			TimeZone:           "America/New_York",
+			AreaCodes:          []string{},
+		},
+	}
+	q := QueryResult{ResultsReturned: 2, TotalFound: 2, StartIndex: 1, EndIndex: 2, ZipCodeEntries: entries}
+
+	test := `zip,type,primary_city,acceptable_cities,unacceptable_cities,county,state,state_name,country,country_name,timezone,area_codes,latitude,longitude
+22151,STANDARD,Springfield,"N Springfield, North Springfield",N Springfld,Fairfax County,VA,Virginia,US,United States of America,America/New_York,"703, 202",38.78,-77.17
+22152,PO BOX,Springfield,,,"Fairfax ""The County""",VA,Virginia,US,United States of America,America/New_York,,,
+`
+	data, err := q.Marshal("CSV")
+	if err != nil {
+		t.Error(err)
+		return
+	} else if data != test {
+		t.Errorf("Invalid CSV Formatting\nFound:\n'%s'\n\nExpecting:\n'%s'\n", data, test)
+	}
+	if name := q.exportFileName("csv"); name != "us_zip_code_database.csv" {
+		t.Errorf("Wrong file name: %s", name)
+	}
+
+	// the export can be read back in as a resource
+	dir, err := ioutil.TempDir("", "zilch")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, q.exportFileName("csv"))
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	ch := make(chan ZipEntry)
+	go CreateReader(path).Read(ch)
+	read := make([]ZipEntry, 0, 2)
+	for entry := range ch {
+		read = append(read, entry)
+	}
+	if !reflect.DeepEqual(read, entries) {
+		t.Errorf("Wrong entries read back\nFound:\n%v\n\nExpecting:\n%v\n", read, entries)
+	}
+}
+
+func Test_Marshal_Results_TSV(t *testing.T) {
+	entry := ZipEntry{ZipCode: "102-0072", City: "Chiyoda", Country: "JP", Latitude: 35.7, Longitude: 139.75}
+	q := QueryResult{ResultsReturned: 1, TotalFound: 1, StartIndex: 1, EndIndex: 1, ZipCodeEntries: []ZipEntry{entry}}
+
+	data, err := q.Marshal("tsv")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	lines := strings.Split(data, "\n")
+	if len(lines) != 3 || lines[1] != "102-0072\t\tChiyoda\t\t\t\t\t\tJP\t\t\t\t35.7\t139.75" {
+		t.Errorf("Invalid TSV Formatting: '%s'", data)
+	}
+}
@@ -0,0 +1,381 @@
+package zilch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// encodeMsgPack marshals the value into MessagePack (see http://msgpack.org),
+// a compact binary format. The output has the same structure and field names
+// as the JSON format, except that float32 values, such as latitudes and
+// longitudes, are written as 32 bit floats.
+func encodeMsgPack(v interface{}) (string, error) {
+	buf := bytes.Buffer{}
+	if err := writeMsgPack(&buf, reflect.ValueOf(v)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func writeMsgPack(buf *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Invalid:
+		buf.WriteByte(0xc0)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		return writeMsgPack(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeMsgPackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		writeMsgPackUint(buf, v.Uint())
+	case reflect.Float32:
+		buf.WriteByte(0xca)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v.Float()))
+	case reflect.String:
+		writeMsgPackString(buf, v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		writeMsgPackHeader(buf, v.Len(), 0x90, 0xdc)
+		for i := 0; i < v.Len(); i++ {
+			if err := writeMsgPack(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("Cannot write MessagePack map with %v keys", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		writeMsgPackHeader(buf, v.Len(), 0x80, 0xde)
+		for _, key := range keys {
+			writeMsgPackString(buf, key.String())
+			if err := writeMsgPack(buf, v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		names, values := msgPackFields(v)
+		writeMsgPackHeader(buf, len(names), 0x80, 0xde)
+		for i, name := range names {
+			writeMsgPackString(buf, name)
+			if err := writeMsgPack(buf, values[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("Cannot write MessagePack value of type %v", v.Type())
+	}
+	return nil
+}
+
+// msgPackFields gets the exported fields of the struct which would be
+// written to JSON, named by their json tags.
+func msgPackFields(v reflect.Value) ([]string, []reflect.Value) {
+	names := make([]string, 0, v.NumField())
+	values := make([]reflect.Value, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		name := field.Name
+		omitEmpty := false
+		if tag := field.Tag.Get("json"); len(tag) > 0 {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			if len(parts[0]) > 0 {
+				name = parts[0]
+			}
+			for _, option := range parts[1:] {
+				omitEmpty = omitEmpty || option == "omitempty"
+			}
+		}
+		value := v.Field(i)
+		if omitEmpty && isEmptyValue(value) {
+			continue
+		}
+		names = append(names, name)
+		values = append(values, value)
+	}
+	return names, values
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func writeMsgPackHeader(buf *bytes.Buffer, length int, fixPrefix, prefix16 byte) {
+	switch {
+	case length < 16:
+		buf.WriteByte(fixPrefix | byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(prefix16)
+		binary.Write(buf, binary.BigEndian, uint16(length))
+	default:
+		buf.WriteByte(prefix16 + 1)
+		binary.Write(buf, binary.BigEndian, uint32(length))
+	}
+}
+
+func writeMsgPackString(buf *bytes.Buffer, s string) {
+	switch length := len(s); {
+	case length < 32:
+		buf.WriteByte(0xa0 | byte(length))
+	case length <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(length))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(length))
+	}
+	buf.WriteString(s)
+}
+
+func writeMsgPackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		writeMsgPackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func writeMsgPackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u < 128:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(u))
+	default:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+	}
+}
+
+// decodeMsgPack unmarshals MessagePack into maps, slices, strings, int64,
+// uint64, float32, float64, bool and nil values.
+func decodeMsgPack(data []byte) (interface{}, error) {
+	d := msgPackDecoder{data: data}
+	v, err := d.read()
+	if err == nil && len(d.data) > 0 {
+		err = fmt.Errorf("Unexpected data after MessagePack value: %v bytes", len(d.data))
+	}
+	return v, err
+}
+
+type msgPackDecoder struct {
+	data []byte
+}
+
+var errMsgPackEnd = errors.New("Unexpected end of MessagePack data")
+
+func (d *msgPackDecoder) next(n int) ([]byte, error) {
+	if len(d.data) < n {
+		return nil, errMsgPackEnd
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+func (d *msgPackDecoder) readLength(size int) (int, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *msgPackDecoder) read() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	t := b[0]
+	switch {
+	case t < 0x80:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xf0 == 0x80:
+		return d.readMap(int(t & 0x0f))
+	case t&0xf0 == 0x90:
+		return d.readArray(int(t & 0x0f))
+	case t&0xe0 == 0xa0:
+		return d.readString(int(t & 0x1f))
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case 0xcb:
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		b, err := d.next(1 << (t - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, c := range b {
+			u = u<<8 | uint64(c)
+		}
+		return u, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (t - 0xd0)
+		b, err := d.next(size)
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, c := range b {
+			u = u<<8 | uint64(c)
+		}
+		// sign extend from the size of the value
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLength(1 << (t - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.readString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readLength(2 << (t - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.readArray(n)
+	case 0xde, 0xdf:
+		n, err := d.readLength(2 << (t - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.readMap(n)
+	}
+	return nil, fmt.Errorf("Unsupported MessagePack type: 0x%x", t)
+}
+
+func (d *msgPackDecoder) readString(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// readArray reads an array of n values. The length comes from the data, so
+// it is checked against the data left, where each value takes at least a
+// byte, before anything is allocated.
+func (d *msgPackDecoder) readArray(n int) (interface{}, error) {
+	if n > len(d.data) {
+		return nil, errMsgPackEnd
+	}
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.read()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+// readMap reads a map of n keys and values, which take at least two bytes
+// each.
+func (d *msgPackDecoder) readMap(n int) (interface{}, error) {
+	if n > len(d.data)/2 {
+		return nil, errMsgPackEnd
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.read()
+		if err != nil {
+			return nil, err
+		}
+		s, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("Unsupported MessagePack map key: %v", key)
+		}
+		if m[s], err = d.read(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
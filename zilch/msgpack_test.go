@@ -0,0 +1,124 @@
+package zilch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// assertSameAsJSON checks that the MessagePack data has the same content as
+// the JSON data.
+func assertSameAsJSON(t *testing.T, msgpack, jsonData string) {
+	decoded, err := decodeMsgPack([]byte(msgpack))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// float32 values are written as JSON with 32 bit precision
+	reencoded, _ := json.Marshal(decoded)
+	var found, expected interface{}
+	json.Unmarshal(reencoded, &found)
+	json.Unmarshal([]byte(jsonData), &expected)
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("MessagePack does not match JSON\nFound:\n%s\n\nExpecting:\n%s\n", reencoded, jsonData)
+	}
+}
+
+func Test_Marshal_Results_MsgPack(t *testing.T) {
+	entries := []ZipEntry{
+		ZipEntry{
+			ZipCode:          "22151",
+			Type:             "STANDARD",
+			City:             "Springfield",
+			AcceptableCities: []string{"N Springfield", "North Springfield"},
+			County:           "Fairfax County",
+			State:            "VA",
+			StateName:        "Virginia",
+			Country:          "US",
+			CountryName:      "United States of America",
+			TimeZone:         "America/New_York",
+			AreaCodes:        []string{"703", "202"},
+			Latitude:         float32(38.78),
+			Longitude:        float32(-77.17),
+			LocalTime:        &LocalTimeInfo{"-05:00", -18000, false, "2026-01-01T07:00:00-05:00"},
+		},
+	}
+	q := QueryResult{
+		ResultsReturned: 1, TotalFound: 300, StartIndex: 1, EndIndex: 1,
+		Facets:         []Facet{Facet{"State", []FacetValue{FacetValue{"VA", 300}}}},
+		ZipCodeEntries: entries,
+	}
+
+	data, err := q.Marshal("MSGPACK")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jsonData, _ := q.Marshal("JSON")
+	assertSameAsJSON(t, data, jsonData)
+	if len(data) >= len(jsonData) {
+		t.Errorf("MessagePack is not smaller than JSON: %v >= %v", len(data), len(jsonData))
+	}
+}
+
+func Test_Marshal_Distribution_MsgPack(t *testing.T) {
+	d := DistributionMarshaller{
+		DistributionEntry{Latitude: 38, Longitude: -78, ZipCodes: 12},
+		DistributionEntry{Latitude: 0.433, Longitude: 0.25, ZipCodes: 70000, Resolution: 0.5, Grid: HexGrid},
+	}
+	data, err := d.Marshal("msgpack")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jsonData, _ := d.Marshal("JSON")
+	assertSameAsJSON(t, data, jsonData)
+}
+
+func Test_Marshal_Countries_MsgPack(t *testing.T) {
+	c := CountryEntryMarshaller{
+		CountryEntry{
+			Country:     "US",
+			CountryName: "United States of America",
+			ZipCodes:    uint32(421),
+			Latitude:    float32(39.5),
+			Longitude:   float32(-77.25),
+			Bounds:      BoundingBox{42.25, -83.5, 36.5, -75},
+			Coverage:    float32(0.5),
+			States: []StateEntry{
+				StateEntry{State: "PA", StateName: "Pennsylvania", ZipCodes: uint32(321)},
+			},
+		},
+	}
+	data, err := c.Marshal("MSGPACK")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jsonData, _ := c.Marshal("JSON")
+	assertSameAsJSON(t, data, jsonData)
+}
+
+func Test_MsgPack_Integers(t *testing.T) {
+	for _, i := range []int64{0, 127, 4294967296, -2147483649, 128, 255, 256, 65535, 65536, -1, -32, -33, -128, -129, -32768, -32769} {
+		data, err := encodeMsgPack(i)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if decoded, err := decodeMsgPack([]byte(data)); err != nil || fmt.Sprint(decoded) != fmt.Sprint(i) {
+			t.Errorf("Wrong integer for %v: %v, %v", i, decoded, err)
+		}
+	}
+}
+
+func Test_MsgPack_Truncated(t *testing.T) {
+	// the lengths of the largest arrays and maps, with no values after them
+	for _, data := range []string{"\xdd\xff\xff\xff\xff", "\xdf\xff\xff\xff\xff", "\x92\x01", "\x81\xa1a"} {
+		if _, err := decodeMsgPack([]byte(data)); err == nil || err.Error() != "Unexpected end of MessagePack data" {
+			t.Errorf("Wrong error for %q: %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package zilch
+
+import (
+	"strconv"
+	"strings"
+)
+
+var (
+	// queryFormats are the formats of the query response, in order of
+	// preference when the client accepts more than one equally.
+	queryFormats = []string{"JSON", "XML", "YAML", "MSGPACK", "GEOJSON", "CSV", "TSV", "KML", "GPX"}
+	// geoFormats are the formats of the distribution and country responses.
+	geoFormats = []string{"JSON", "XML", "YAML", "MSGPACK", "GEOJSON"}
+	// documentFormats are the formats of every other response.
+	documentFormats = []string{"JSON", "XML", "YAML"}
+)
+
+// acceptRange is a single media range of an Accept header, such as
+// "text/*;q=0.5".
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+func parseAccept(accept string) []acceptRange {
+	ranges := make([]acceptRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if len(mediaType) == 0 {
+			continue
+		}
+		if mediaType == "*" {
+			mediaType = "*/*"
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") || strings.HasPrefix(param, "Q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q >= 0 && q <= 1 {
+					quality = q
+				} else {
+					quality = 0
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, quality})
+	}
+	return ranges
+}
+
+// specificity gets how closely the range matches the media type: 3 for an
+// exact match, 2 for "type/*", 1 for "*/*" and 0 when it does not match.
+func (r acceptRange) specificity(mediaType string) int {
+	switch {
+	case r.mediaType == mediaType:
+		return 3
+	case r.mediaType == "*/*":
+		return 1
+	case strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, r.mediaType[:len(r.mediaType)-1]):
+		return 2
+	}
+	return 0
+}
+
+// formatQuality gets the quality of the most specific range matching one of
+// the media types of a format. Only the first media type is matched against
+// wildcards, so that the aliases such as "text/json" do not make the format
+// match "text/*".
+func formatQuality(ranges []acceptRange, mediaTypes []string) float64 {
+	best := 0
+	quality := 0.0
+	for _, r := range ranges {
+		for i, mediaType := range mediaTypes {
+			s := r.specificity(mediaType)
+			if i > 0 && s < 3 {
+				continue
+			}
+			if s > best || (s == best && s > 0 && r.quality > quality) {
+				best = s
+				quality = r.quality
+			}
+		}
+	}
+	return quality
+}
+
+// negotiateFormat picks the format with the highest quality in the Accept
+// header, preferring the earliest of the formats when there is a tie. An empty
+// header accepts the first format. The format is empty when none of the
+// formats is acceptable.
+func negotiateFormat(accept string, formats []string) string {
+	if len(strings.TrimSpace(accept)) == 0 {
+		return formats[0]
+	}
+	ranges := parseAccept(accept)
+	format := ""
+	quality := 0.0
+	for _, f := range formats {
+		if q := formatQuality(ranges, formatMediaTypes(f)); q > quality {
+			format = f
+			quality = q
+		}
+	}
+	return format
+}
+
+// acceptableMediaTypes lists the media types of the formats, for the body of
+// a 406 Not Acceptable response.
+func acceptableMediaTypes(formats []string) string {
+	mediaTypes := make([]string, len(formats))
+	for i, f := range formats {
+		mediaTypes[i] = formatMediaTypes(f)[0]
+	}
+	return strings.Join(mediaTypes, ", ")
+}
+
+// formatMediaTypes gets the media types which select a format in an Accept
+// header.
+func formatMediaTypes(format string) []string {
+	f, _ := lookupFormat(format)
+	return f.MediaTypes
+}
@@ -0,0 +1,81 @@
+package zilch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hoisie/web"
+)
+
+func Test_Negotiate_Format(t *testing.T) {
+	tests := []struct {
+		accept   string
+		formats  []string
+		expected string
+	}{
+		{"", queryFormats, "JSON"},
+		{"*/*", queryFormats, "JSON"},
+		{"application/json", queryFormats, "JSON"},
+		{"text/xml", queryFormats, "XML"},
+		{"application/xml", documentFormats, "XML"},
+		{"application/x-yaml", geoFormats, "YAML"},
+		{"application/msgpack", geoFormats, "MSGPACK"},
+		{"application/geo+json, application/json;q=0.5", geoFormats, "GEOJSON"},
+		{"application/json;q=0.5, text/csv", queryFormats, "CSV"},
+		{"text/*;q=0.9, application/json;q=0.8", queryFormats, "XML"},
+		{"TEXT/TAB-SEPARATED-VALUES", queryFormats, "TSV"},
+		{"application/gpx+xml;q=0.2, application/vnd.google-earth.kml+xml;q=0.3", queryFormats, "KML"},
+		{"application/json, text/plain, */*", documentFormats, "JSON"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", queryFormats, "XML"},
+		{"*/*;q=0.1, application/json;q=0", documentFormats, "XML"},
+		{"text/csv", documentFormats, ""},
+		{"application/msgpack", documentFormats, ""},
+		{"application/json;q=0", documentFormats, ""},
+		{"image/png", queryFormats, ""},
+	}
+
+	for _, test := range tests {
+		if found := negotiateFormat(test.accept, test.formats); found != test.expected {
+			t.Errorf("Wrong format for '%s', expected '%s' but found '%s'", test.accept, test.expected, found)
+		}
+	}
+}
+
+func testResponseWriter(format, accept string) (ResponseWriter, *httptest.ResponseRecorder) {
+	request, _ := http.NewRequest("GET", "/query", nil)
+	if len(accept) > 0 {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	return ResponseWriter{&web.Context{Request: request, ResponseWriter: recorder}, format}, recorder
+}
+
+func Test_ResponseWriter_Content_Negotiation(t *testing.T) {
+	q := QueryResult{ResultsReturned: 1, TotalFound: 1, StartIndex: 1, EndIndex: 1, ZipCodeEntries: []ZipEntry{ZipEntry{ZipCode: "22151", AcceptableCities: []string{}, UnacceptableCities: []string{}, AreaCodes: []string{}}}}
+
+	writer, recorder := testResponseWriter("", "text/yaml;q=0.9, application/json;q=0.5")
+	writer.SendQueryResponse(q)
+	if recorder.Code != 200 || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/yaml") {
+		t.Errorf("Wrong response %v: %v", recorder.Code, recorder.Header())
+	}
+	if recorder.Header().Get("Vary") != "Accept" {
+		t.Errorf("Expected Vary: Accept, found %v", recorder.Header())
+	}
+
+	writer, recorder = testResponseWriter("", "text/csv")
+	writer.SendRegionResponse(Region{Type: "ZipCode", Code: "22151"})
+	if recorder.Code != 406 || !strings.Contains(recorder.Body.String(), "application/json, text/xml, text/yaml") {
+		t.Errorf("Expected a 406 response, found %v: %s", recorder.Code, recorder.Body.String())
+	}
+
+	writer, recorder = testResponseWriter("xml", "text/csv")
+	writer.SendQueryResponse(q)
+	if recorder.Code != 200 || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/xml") {
+		t.Errorf("Expected the extension to win, found %v: %v", recorder.Code, recorder.Header())
+	}
+	if len(recorder.Header().Get("Vary")) > 0 {
+		t.Errorf("Unexpected Vary header with an extension: %v", recorder.Header())
+	}
+}
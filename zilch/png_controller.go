@@ -1,7 +1,8 @@
 package zilch
 
 import (
-	"errors"
+	"bytes"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
@@ -23,42 +24,76 @@ type PngController struct {
 
 // RenderDistributionImage renders the distribution image for the globe.
 func (c PngController) RenderDistributionImage(ctx *web.Context, scale string) {
+	writer := ResponseWriter{ctx, "JSON"}
+	if writer.databaseNotModified(c.database) {
+		return
+	}
 	intScale := c.convertScale(scale)
 
-	if img, err := c.getBackgroundImage(intScale); err != nil {
-		rw := ResponseWriter{ctx, "JSON"}
-		rw.SendError(err)
-	} else {
+	c.sendImage(writer, fmt.Sprintf("distmap_%v", intScale), func() (image.Image, error) {
+		img, err := c.getBackgroundImage(intScale)
+		if err != nil {
+			return nil, err
+		}
 		distributions := c.database.GetDistributions()
 		sort.Sort(DistributionSorter(distributions))
 
 		for _, dist := range distributions {
 			c.drawDistribution(img, float32(dist.Latitude), float32(dist.Longitude), float32(intScale)/float32(2), int(dist.ZipCodes))
 		}
-
-		ctx.ContentType("image/png")
-		png.Encode(ctx.ResponseWriter, img)
-	}
+		return img, nil
+	})
 }
 
 // RenderImage renders the simple distribution image.
 func (c PngController) RenderImage(ctx *web.Context, scale string) {
-	intScale := c.convertScale(scale)
-
-	img, err := c.getBackgroundImage(intScale)
-	if err != nil {
-		rw := ResponseWriter{ctx, "JSON"}
-		rw.SendError(err)
+	writer := ResponseWriter{ctx, "JSON"}
+	if writer.databaseNotModified(c.database) {
 		return
 	}
+	intScale := c.convertScale(scale)
 
-	for _, cim := range c.database.CountryIndexMap {
-		for _, entry := range cim.Entries {
-			c.drawPoint(img, entry.Latitude, entry.Longitude, float32(intScale)/float32(2))
+	c.sendImage(writer, fmt.Sprintf("map_%v", intScale), func() (image.Image, error) {
+		img, err := c.getBackgroundImage(intScale)
+		if err != nil {
+			return nil, err
+		}
+		for _, cim := range c.database.CountryIndexMap {
+			for _, entry := range cim.Entries {
+				c.drawPoint(img, entry.Latitude, entry.Longitude, float32(intScale)/float32(2))
+			}
+		}
+		return img, nil
+	})
+}
+
+// sendImage sends the PNG image with the key from the database's image cache,
+// rendering it when it is not cached. Images are only cached once the
+// database is fully loaded, since they show all of its zip codes.
+func (c PngController) sendImage(writer ResponseWriter, key string, render func() (image.Image, error)) {
+	var data []byte
+	if cached, found := c.database.imageCache.Get(c.database.Version, key); found {
+		data = cached.([]byte)
+	} else {
+		img, err := render()
+		if err != nil {
+			writer.SendError(err)
+			return
+		}
+		buf := bytes.Buffer{}
+		if err := png.Encode(&buf, img); err != nil {
+			writer.SendError(err)
+			return
+		}
+		data = buf.Bytes()
+		if c.database.IsFullyLoaded() {
+			c.database.imageCache.Add(c.database.Version, key, data, int64(len(data)))
 		}
 	}
-	ctx.ContentType("image/png")
-	png.Encode(ctx.ResponseWriter, img)
+
+	writer.ctx.ContentType("image/png")
+	writer.ctx.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	writer.ctx.ResponseWriter.Write(data)
 }
 
 func (c PngController) drawPoint(img *image.RGBA, lat, lng, scale float32) {
@@ -103,7 +138,7 @@ func (c PngController) convertScale(scale string) int {
 
 func (c PngController) getBackgroundImage(scale int) (*image.RGBA, error) {
 	if scale < 1 || scale > 20 {
-		return nil, errors.New("Image is too large or too small")
+		return nil, badRequestError(ErrorInvalidParameter, "Image is too large or too small")
 	}
 	file, err := os.Open("./web/images/world-big-2-grey.jpg")
 	defer file.Close()
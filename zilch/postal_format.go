@@ -0,0 +1,200 @@
+package zilch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PostalCodeFormat describes what a valid postal code looks like in a single
+// country. The Pattern is matched against the upper cased code, while the
+// lengths only count the letters and digits of the code.
+type PostalCodeFormat struct {
+	Country           string
+	Pattern           string
+	MinLength         int
+	MaxLength         int
+	AllowedCharacters string
+	Example           string
+
+	pattern *regexp.Regexp
+	allowed *regexp.Regexp
+}
+
+// newPostalCodeFormat creates a format with its patterns compiled, so that a
+// malformed pattern in the table fails as soon as the package is loaded.
+func newPostalCodeFormat(country, pattern string, minLength, maxLength int, allowedCharacters, example string) PostalCodeFormat {
+	return PostalCodeFormat{
+		Country:           country,
+		Pattern:           pattern,
+		MinLength:         minLength,
+		MaxLength:         maxLength,
+		AllowedCharacters: allowedCharacters,
+		Example:           example,
+		pattern:           regexp.MustCompile(pattern),
+		allowed:           regexp.MustCompile("^[" + allowedCharacters + "]*$"),
+	}
+}
+
+// FormatValidation is the result of checking a postal code against the
+// PostalCodeFormat of its country.
+type FormatValidation struct {
+	ZipCode string
+	Country string
+	Valid   bool
+	Reason  string
+	Format  PostalCodeFormat
+}
+
+// PostalCodeFormats is the built in table of postal code formats, keyed by
+// country code.
+var PostalCodeFormats = map[string]PostalCodeFormat{
+	"AR": newPostalCodeFormat("AR", `^([A-Z]\d{4}[A-Z]{3}|\d{4})$`, 4, 8, "0-9A-Z", "C1425DKF"),
+	"AU": newPostalCodeFormat("AU", `^\d{4}$`, 4, 4, "0-9", "2600"),
+	"BR": newPostalCodeFormat("BR", `^\d{5}-?\d{3}$`, 8, 8, "0-9", "69945-000"),
+	"CA": newPostalCodeFormat("CA", `^[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z] ?\d[ABCEGHJ-NPRSTV-Z]\d$`, 6, 6, "0-9A-Z", "T0A 1A0"),
+	"DE": newPostalCodeFormat("DE", `^\d{5}$`, 5, 5, "0-9", "01945"),
+	"ES": newPostalCodeFormat("ES", `^(0[1-9]|[1-4]\d|5[0-2])\d{3}$`, 5, 5, "0-9", "04001"),
+	"FR": newPostalCodeFormat("FR", `^\d{5}$`, 5, 5, "0-9", "75008"),
+	"GB": newPostalCodeFormat("GB", `^(GIR ?0AA|[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2})$`, 5, 7, "0-9A-Z", "SW1A 1AA"),
+	"IN": newPostalCodeFormat("IN", `^[1-9]\d{5}$`, 6, 6, "0-9", "744101"),
+	"IT": newPostalCodeFormat("IT", `^\d{5}$`, 5, 5, "0-9", "67010"),
+	"JP": newPostalCodeFormat("JP", `^\d{3}-?\d{4}$`, 7, 7, "0-9", "102-0072"),
+	"MX": newPostalCodeFormat("MX", `^\d{5}$`, 5, 5, "0-9", "06600"),
+	"NL": newPostalCodeFormat("NL", `^[1-9]\d{3} ?[A-Z]{2}$`, 6, 6, "0-9A-Z", "1012 JS"),
+	"US": newPostalCodeFormat("US", `^\d{5}(-?\d{4})?$`, 5, 9, "0-9", "22151"),
+	"ZA": newPostalCodeFormat("ZA", `^\d{4}$`, 4, 4, "0-9", "0002"),
+}
+
+var postalCodeSeparators = regexp.MustCompile("[ -]")
+
+// ValidatePostalCodeFormat checks that the postal code is well formed for
+// the country, whether or not the code is in the database.
+func ValidatePostalCodeFormat(country, zipCode string) (FormatValidation, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	v := FormatValidation{ZipCode: zipCode, Country: country}
+
+	format, found := PostalCodeFormats[country]
+	if !found {
+		return v, notFoundError(ErrorCountryNotFound, "No postal code format for country %s", country)
+	}
+	v.Format = format
+
+	code := strings.ToUpper(strings.TrimSpace(zipCode))
+	stripped := postalCodeSeparators.ReplaceAllString(code, "")
+	switch {
+	case len(stripped) == 0:
+		v.Reason = "The postal code is empty"
+	case !format.hasAllowedCharacters(stripped):
+		v.Reason = fmt.Sprintf("The postal code may only contain the characters %s", format.AllowedCharacters)
+	case len(stripped) < format.MinLength:
+		v.Reason = fmt.Sprintf("The postal code is too short, it must have at least %v characters", format.MinLength)
+	case len(stripped) > format.MaxLength:
+		v.Reason = fmt.Sprintf("The postal code is too long, it must have at most %v characters", format.MaxLength)
+	case !format.pattern.MatchString(code):
+		v.Reason = fmt.Sprintf("The postal code does not match the format, eg: %s", format.Example)
+	default:
+		v.Valid = true
+	}
+	return v, nil
+}
+
+// AcceptsPrefix determines whether the partial postal code could be the
+// start of a valid postal code, which is how zip codes are queried.
+func (p PostalCodeFormat) AcceptsPrefix(zipCode string) bool {
+	stripped := postalCodeSeparators.ReplaceAllString(strings.ToUpper(strings.TrimSpace(zipCode)), "")
+	return len(stripped) <= p.MaxLength && p.hasAllowedCharacters(stripped)
+}
+
+func (p PostalCodeFormat) hasAllowedCharacters(code string) bool {
+	return p.allowed.MatchString(code)
+}
+
+// NormalizedPostalCode is the canonical display form of a postal code.
+type NormalizedPostalCode struct {
+	ZipCode    string
+	Country    string
+	Normalized string
+}
+
+var postalCodeNormalizers = map[string]func(string) string{
+	"AU": padPostalCode(4),
+	"BR": splitPostalCode(8, 5, "-"),
+	"CA": splitPostalCode(6, 3, " "),
+	"DE": padPostalCode(5),
+	"ES": padPostalCode(5),
+	"FR": padPostalCode(5),
+	"GB": func(code string) string {
+		// partial codes are prefixes, so they are left as they are
+		if !PostalCodeFormats["GB"].pattern.MatchString(code) {
+			return code
+		}
+		return code[:len(code)-3] + " " + code[len(code)-3:]
+	},
+	"IT": padPostalCode(5),
+	"JP": splitPostalCode(7, 3, "-"),
+	"MX": padPostalCode(5),
+	"NL": splitPostalCode(6, 4, " "),
+	"US": func(code string) string {
+		return splitPostalCode(9, 5, "-")(padPostalCode(5)(code))
+	},
+	"ZA": padPostalCode(4),
+}
+
+// NormalizePostalCode converts a postal code into the canonical display form
+// for the country, eg: 1020072 becomes 102-0072 in JP and sw1a1aa becomes
+// SW1A 1AA in GB. Codes from countries without a normalizer are only trimmed
+// and upper cased.
+func NormalizePostalCode(country, zipCode string) string {
+	code := strings.ToUpper(strings.TrimSpace(zipCode))
+	normalizer, found := postalCodeNormalizers[strings.ToUpper(country)]
+	if !found {
+		return code
+	}
+	return normalizer(postalCodeSeparators.ReplaceAllString(code, ""))
+}
+
+// postalCodeInwardLengths are the lengths of the inward part of the postal
+// codes of the countries whose database only holds the outward part, such as
+// the FSA of a Canadian code or the outward code of a British one.
+var postalCodeInwardLengths = map[string]int{
+	"CA": 3,
+	"GB": 3,
+}
+
+// outwardPostalCode gets the outward part of a full postal code, eg: T0A of
+// T0A 1A0 in CA and SW1A of SW1A 1AA in GB. It is false for codes which are
+// not full codes of a country with outward codes.
+func outwardPostalCode(country, zipCode string) (string, bool) {
+	country = strings.ToUpper(country)
+	length, found := postalCodeInwardLengths[country]
+	if !found {
+		return "", false
+	}
+	code := postalCodeSeparators.ReplaceAllString(strings.ToUpper(strings.TrimSpace(zipCode)), "")
+	if !PostalCodeFormats[country].pattern.MatchString(code) {
+		return "", false
+	}
+	return code[:len(code)-length], true
+}
+
+// padPostalCode adds leading zeros to numeric codes which have lost them,
+// eg: when a spreadsheet has treated the code as a number.
+func padPostalCode(length int) func(string) string {
+	return func(code string) string {
+		if len(code) == 0 || len(code) >= length || strings.Trim(code, "0123456789") != "" {
+			return code
+		}
+		return strings.Repeat("0", length-len(code)) + code
+	}
+}
+
+// splitPostalCode inserts the separator into codes of the full length.
+func splitPostalCode(length, at int, separator string) func(string) string {
+	return func(code string) string {
+		if len(code) != length {
+			return code
+		}
+		return code[:at] + separator + code[at:]
+	}
+}
@@ -0,0 +1,102 @@
+package zilch
+
+import (
+	"testing"
+)
+
+func Test_ValidatePostalCodeFormat(t *testing.T) {
+	testFormat := func(country, zipCode string, expected bool) {
+		v, err := ValidatePostalCodeFormat(country, zipCode)
+		if err != nil {
+			t.Error(err)
+		} else if v.Valid != expected {
+			t.Errorf("%s %s should have been valid: %v, reason: %s", country, zipCode, expected, v.Reason)
+		}
+	}
+
+	testFormat("GB", "SW1A 1AA", true)
+	testFormat("gb", "sw1a1aa", true)
+	testFormat("GB", "B99", false)
+	testFormat("CA", "T0A 1A0", true)
+	testFormat("CA", "T0A", false)
+	testFormat("CA", "D0A 1A0", false)
+	testFormat("JP", "102-0072", true)
+	testFormat("JP", "1020072", true)
+	testFormat("JP", "102-007", false)
+	testFormat("BR", "69945-000", true)
+	testFormat("BR", "69945-00A", false)
+	testFormat("US", "22151-1234", true)
+	testFormat("DE", "01945", true)
+	testFormat("DE", "1945", false)
+
+	if _, err := ValidatePostalCodeFormat("XX", "12345"); err == nil {
+		t.Error("Expected an error for a country without a format")
+	}
+
+	for country, format := range PostalCodeFormats {
+		testFormat(country, format.Example, true)
+	}
+}
+
+func Test_AcceptsPrefix(t *testing.T) {
+	if !PostalCodeFormats["CA"].AcceptsPrefix("t0a") {
+		t.Error("t0a should be a valid CA prefix")
+	}
+	if PostalCodeFormats["DE"].AcceptsPrefix("01A") {
+		t.Error("01A should not be a valid DE prefix")
+	}
+	if PostalCodeFormats["US"].AcceptsPrefix("1234567890") {
+		t.Error("1234567890 should be too long for a US zip code")
+	}
+
+	database := &Database{CountryIndexMap: make(map[string]CountryIndex)}
+	if _, err := database.ExecQuery(map[string]string{"Country": "DE", "ZipCode": "ABC"}); err == nil || err.Error() != "Invalid zip code ABC for country DE" {
+		t.Errorf("Expected an invalid zip code error, got %v", err)
+	}
+}
+
+func Test_NormalizePostalCode(t *testing.T) {
+	testNormalize := func(country, zipCode, expected string) {
+		if normalized := NormalizePostalCode(country, zipCode); normalized != expected {
+			t.Errorf("%s %s was normalized to %s, expected %s", country, zipCode, normalized, expected)
+		}
+	}
+
+	testNormalize("CA", "t0a", "T0A")
+	testNormalize("CA", "T0A-", "T0A")
+	testNormalize("CA", "t0a1a0", "T0A 1A0")
+	testNormalize("JP", "1020072", "102-0072")
+	testNormalize("JP", "102-0072", "102-0072")
+	testNormalize("GB", "sw1a1aa", "SW1A 1AA")
+	testNormalize("GB", "bd97", "BD97")
+	testNormalize("GB", "SW1A1", "SW1A1")
+	testNormalize("GB", "sw1a 1", "SW1A1")
+	testNormalize("GB", "m11ae", "M1 1AE")
+	testNormalize("GB", "gir0aa", "GIR 0AA")
+	testNormalize("DE", "1945", "01945")
+	testNormalize("IT", "0100", "00100")
+	testNormalize("ES", "4001", "04001")
+	testNormalize("AU", "221", "0221")
+	testNormalize("US", "221511234", "22151-1234")
+	testNormalize("BR", "69945000", "69945-000")
+	testNormalize("AR", " c1425dkf ", "C1425DKF")
+}
+
+func Test_OutwardPostalCode(t *testing.T) {
+	tests := []struct {
+		country, zipCode, outward string
+		found                     bool
+	}{
+		{"CA", "T0A 1A0", "T0A", true},
+		{"ca", "t0a1a0", "T0A", true},
+		{"GB", "SW1A 1AA", "SW1A", true},
+		{"GB", "B99 1AA", "B99", true},
+		{"GB", "SW1A", "", false},
+		{"US", "22151-1234", "", false},
+	}
+	for _, test := range tests {
+		if outward, found := outwardPostalCode(test.country, test.zipCode); outward != test.outward || found != test.found {
+			t.Errorf("Wrong outward code of %v %v: %v %v", test.country, test.zipCode, outward, found)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package zilch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoisie/web"
+)
+
+// APIKey is a client of the server, and the limits on its requests. A zero
+// RequestsPerSecond or DailyQuota leaves the rate or the number of requests
+// per day unlimited.
+type APIKey struct {
+	Key  string
+	Name string
+	// RequestsPerSecond is the rate at which requests are allowed.
+	RequestsPerSecond float64
+	// Burst is the number of requests which may be sent at once, at least 1
+	// and by default the RequestsPerSecond rounded up.
+	Burst int
+	// DailyQuota is the number of requests allowed each day, which starts at
+	// midnight UTC.
+	DailyQuota int
+}
+
+// RateLimitConfig is the configuration of the API keys. Without an Anonymous
+// tier every request needs one of the Keys. The anonymous limits apply to
+// each client address separately. The X-Forwarded-For header is only
+// believed in requests from the TrustedProxies, which are IP addresses or
+// CIDR ranges such as "10.0.0.0/8".
+type RateLimitConfig struct {
+	Anonymous      *APIKey
+	Keys           []APIKey
+	TrustedProxies []string
+}
+
+// LoadRateLimitConfig reads the configuration of the API keys from a JSON
+// file.
+func LoadRateLimitConfig(file string) (RateLimitConfig, error) {
+	var config RateLimitConfig
+	in, err := os.Open(file)
+	if err != nil {
+		return config, err
+	}
+	defer in.Close()
+
+	if err := json.NewDecoder(in).Decode(&config); err != nil {
+		return config, fmt.Errorf("Invalid API key file %s: %v", file, err)
+	}
+	for _, key := range config.Keys {
+		if len(key.Key) == 0 {
+			return config, fmt.Errorf("Invalid API key file %s: %s has no key", file, key.Name)
+		}
+	}
+	for _, proxy := range config.TrustedProxies {
+		if _, err := parseNetwork(proxy); err != nil {
+			return config, fmt.Errorf("Invalid API key file %s: %v", file, err)
+		}
+	}
+	return config, nil
+}
+
+// parseNetwork parses a CIDR range, or an IP address as a range of one
+// address.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %s", value)
+		}
+		return network, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("Invalid trusted proxy %s", value)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}, nil
+}
+
+// tokenBucket allows requests at a steady rate, with bursts of up to its
+// capacity.
+type tokenBucket struct {
+	tokens   float64
+	capacity float64
+	rate     float64
+	updated  time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	capacity := float64(burst)
+	if burst < 1 {
+		capacity = math.Max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{capacity, capacity, rate, now}
+}
+
+// take takes a token for a request, or gets how long until there is one.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// full gets when the bucket will be full again.
+func (b *tokenBucket) full() time.Time {
+	return b.updated.Add(time.Duration((b.capacity - b.tokens) / b.rate * float64(time.Second)))
+}
+
+// clientUsage is the usage of an API key, or of an anonymous client address,
+// on the current day.
+type clientUsage struct {
+	bucket   *tokenBucket
+	requests int
+	quota    int
+}
+
+// idle checks whether forgetting the usage would change nothing, because
+// its bucket is full again and none of its daily quota is used.
+func (u *clientUsage) idle(now time.Time) bool {
+	if u.quota > 0 && u.requests > 0 {
+		return false
+	}
+	return u.bucket == nil || !u.bucket.full().After(now)
+}
+
+// sweepInterval is how often the idle usage is removed, so that the usage
+// of many short lived client addresses does not pile up during the day.
+const sweepInterval = time.Minute
+
+// RateLimiter limits the requests of each API key, and of anonymous clients.
+// It is safe for concurrent use.
+type RateLimiter struct {
+	anonymous *APIKey
+	keys      map[string]APIKey
+	proxies   []*net.IPNet
+	usage     map[string]*clientUsage
+	day       string
+	swept     time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+// NewRateLimiter creates a rate limiter for the configured API keys. Trusted
+// proxies which can not be parsed are ignored.
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	keys := make(map[string]APIKey)
+	for _, key := range config.Keys {
+		keys[key.Key] = key
+	}
+	proxies := make([]*net.IPNet, 0, len(config.TrustedProxies))
+	for _, proxy := range config.TrustedProxies {
+		if network, err := parseNetwork(proxy); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return &RateLimiter{
+		anonymous: config.Anonymous,
+		keys:      keys,
+		proxies:   proxies,
+		usage:     make(map[string]*clientUsage),
+		now:       time.Now,
+	}
+}
+
+// Handler checks the API key of each request, which is sent in the X-API-Key
+// header or the api_key parameter, before passing the request on to the next
+// handler. Every response has the X-RateLimit headers of its key. Requests
+// over the rate or the daily quota get a 429 Too Many Requests, with a
+// Retry-After header, and requests without a valid key get a 401
+// Unauthorized.
+func (l *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := l.allow(w.Header(), r); err != nil {
+			format := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+			writer := ResponseWriter{&web.Context{Request: r, ResponseWriter: w}, format}
+			writer.SendError(err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow counts the request against the limits of its API key, and sets the
+// X-RateLimit headers. The error explains why a request is not allowed.
+func (l *RateLimiter) allow(header http.Header, r *http.Request) error {
+	key, client, err := l.identify(r)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now().UTC()
+	// the usage of every client starts again each day
+	if day := now.Format("2006-01-02"); day != l.day {
+		l.usage = make(map[string]*clientUsage)
+		l.day = day
+		l.swept = now
+	} else if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+	usage, found := l.usage[client]
+	if !found {
+		usage = &clientUsage{quota: key.DailyQuota}
+		if key.RequestsPerSecond > 0 {
+			usage.bucket = newTokenBucket(key.RequestsPerSecond, key.Burst, now)
+		}
+		l.usage[client] = usage
+	}
+
+	if key.DailyQuota > 0 {
+		header.Set("X-RateLimit-Daily-Limit", strconv.Itoa(key.DailyQuota))
+		if usage.requests >= key.DailyQuota {
+			header.Set("X-RateLimit-Daily-Remaining", "0")
+			tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+			header.Set("Retry-After", retryAfter(tomorrow.Sub(now)))
+			return Error{429, ErrorQuotaExceeded, fmt.Sprintf("The daily quota of %v requests has been used up", key.DailyQuota)}
+		}
+	}
+	if usage.bucket != nil {
+		allowed, wait := usage.bucket.take(now)
+		header.Set("X-RateLimit-Limit", strconv.Itoa(int(usage.bucket.capacity)))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(int(usage.bucket.tokens)))
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(usage.bucket.full().Unix(), 10))
+		if !allowed {
+			header.Set("Retry-After", retryAfter(wait))
+			return Error{429, ErrorRateLimited, fmt.Sprintf("Too many requests, the limit is %v per second", key.RequestsPerSecond)}
+		}
+	}
+
+	usage.requests++
+	if key.DailyQuota > 0 {
+		header.Set("X-RateLimit-Daily-Remaining", strconv.Itoa(key.DailyQuota-usage.requests))
+	}
+	return nil
+}
+
+// sweep removes the usage of the idle clients.
+func (l *RateLimiter) sweep(now time.Time) {
+	for client, usage := range l.usage {
+		if usage.idle(now) {
+			delete(l.usage, client)
+		}
+	}
+	l.swept = now
+}
+
+// identify finds the API key of the request, and the client whose usage is
+// counted, which is the key itself or the address of an anonymous client.
+func (l *RateLimiter) identify(r *http.Request) (APIKey, string, error) {
+	value := r.Header.Get("X-API-Key")
+	if len(value) == 0 {
+		value = r.URL.Query().Get("api_key")
+	}
+	if len(value) > 0 {
+		if key, found := l.keys[value]; found {
+			return key, "key:" + value, nil
+		}
+		return APIKey{}, "", Error{401, ErrorInvalidAPIKey, "Invalid API key"}
+	}
+	if l.anonymous == nil {
+		return APIKey{}, "", Error{401, ErrorAPIKeyRequired, "An API key is required, in the X-API-Key header or the api_key parameter"}
+	}
+	return *l.anonymous, "address:" + l.clientAddress(r), nil
+}
+
+// clientAddress gets the address of the client. Behind a trusted proxy it is
+// the last address in the X-Forwarded-For header, which is the one added by
+// the proxy. Any other client could send the header to dodge its limits, so
+// there it is ignored.
+func (l *RateLimiter) clientAddress(r *http.Request) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = h
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); len(forwarded) > 0 && l.trusted(host) {
+		addresses := strings.Split(forwarded, ",")
+		return strings.TrimSpace(addresses[len(addresses)-1])
+	}
+	return host
+}
+
+// trusted checks whether the address is one of the trusted proxies.
+func (l *RateLimiter) trusted(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range l.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter gets the whole number of seconds to wait, at least one.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds()))))
+}
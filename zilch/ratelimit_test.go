@@ -0,0 +1,201 @@
+package zilch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRateLimiter(now *time.Time) *RateLimiter {
+	limiter := NewRateLimiter(RateLimitConfig{
+		Anonymous: &APIKey{Name: "Anonymous", RequestsPerSecond: 1, Burst: 2},
+		Keys: []APIKey{
+			{Key: "fast", Name: "Fast", RequestsPerSecond: 10, DailyQuota: 3},
+			{Key: "unlimited", Name: "Unlimited"},
+		},
+		TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16", "bogus"},
+	})
+	limiter.now = func() time.Time { return *now }
+	return limiter
+}
+
+func testLimitedRequest(limiter *RateLimiter, url string, headers map[string]string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest("GET", url, nil)
+	request.RemoteAddr = "10.0.0.1:5000"
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})).ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_RateLimiter_Rate(t *testing.T) {
+	now := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := testRateLimiter(&now)
+
+	// anonymous clients get a burst of 2 requests, then 1 per second
+	for i, expected := range []int{200, 200, 429} {
+		recorder := testLimitedRequest(limiter, "/countries.yaml", nil)
+		if recorder.Code != expected {
+			t.Errorf("Wrong status for request %v: %v", i, recorder.Code)
+		}
+	}
+	recorder := testLimitedRequest(limiter, "/countries.yaml", nil)
+	if recorder.Header().Get("Retry-After") != "1" || recorder.Header().Get("X-RateLimit-Limit") != "2" ||
+		recorder.Header().Get("X-RateLimit-Remaining") != "0" || !strings.Contains(recorder.Body.String(), "Code:    RATE_LIMITED") {
+		t.Errorf("Wrong response %v: %s", recorder.Header(), recorder.Body.String())
+	}
+
+	// each anonymous address behind a trusted proxy has its own limit
+	if recorder := testLimitedRequest(limiter, "/countries.yaml", map[string]string{"X-Forwarded-For": "10.0.0.9, 10.0.0.2"}); recorder.Code != 200 {
+		t.Errorf("Wrong status for another address: %v", recorder.Code)
+	}
+
+	now = now.Add(time.Second)
+	recorder = testLimitedRequest(limiter, "/countries.yaml", nil)
+	if recorder.Code != 200 || recorder.Body.String() != "OK" {
+		t.Errorf("Expected a request after a second, found %v", recorder.Code)
+	}
+	if reset := recorder.Header().Get("X-RateLimit-Reset"); reset != "1425211203" {
+		t.Errorf("Wrong reset %v", reset)
+	}
+}
+
+func Test_RateLimiter_Untrusted_Proxy(t *testing.T) {
+	now := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := testRateLimiter(&now)
+
+	// a client which is not a trusted proxy can not pick its own address
+	for i, expected := range []int{200, 200, 429} {
+		request, _ := http.NewRequest("GET", "/countries.yaml", nil)
+		request.RemoteAddr = "172.16.0.1:5000"
+		request.Header.Set("X-Forwarded-For", "10.0.0."+strconv.Itoa(i+10))
+		recorder := httptest.NewRecorder()
+		limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(recorder, request)
+		if recorder.Code != expected {
+			t.Errorf("Wrong status for request %v: %v", i, recorder.Code)
+		}
+	}
+
+	request, _ := http.NewRequest("GET", "/countries.yaml", nil)
+	request.RemoteAddr = "192.168.4.7:5000"
+	request.Header.Set("X-Forwarded-For", "10.0.0.20")
+	if address := limiter.clientAddress(request); address != "10.0.0.20" {
+		t.Errorf("Wrong address behind a trusted proxy %v", address)
+	}
+	request.RemoteAddr = "[::1]:5000"
+	if address := limiter.clientAddress(request); address != "::1" {
+		t.Errorf("Wrong address of an untrusted client %v", address)
+	}
+}
+
+func Test_RateLimiter_Sweep(t *testing.T) {
+	now := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := testRateLimiter(&now)
+
+	for i := 0; i < 5; i++ {
+		testLimitedRequest(limiter, "/countries.json", map[string]string{"X-Forwarded-For": "10.1.0." + strconv.Itoa(i)})
+	}
+	testLimitedRequest(limiter, "/countries.json?api_key=fast", nil)
+	testLimitedRequest(limiter, "/countries.json?api_key=unlimited", nil)
+	if len(limiter.usage) != 7 {
+		t.Errorf("Wrong number of clients %v", len(limiter.usage))
+	}
+
+	// only the key with some of its quota used is kept, along with the new
+	// request
+	now = now.Add(sweepInterval)
+	testLimitedRequest(limiter, "/countries.json", nil)
+	if _, found := limiter.usage["key:fast"]; !found || len(limiter.usage) != 2 {
+		t.Errorf("Wrong clients after a sweep %v", limiter.usage)
+	}
+	if recorder := testLimitedRequest(limiter, "/countries.json?api_key=fast", nil); recorder.Header().Get("X-RateLimit-Daily-Remaining") != "1" {
+		t.Errorf("Wrong quota after a sweep %v", recorder.Header())
+	}
+}
+
+func Test_RateLimiter_Quota(t *testing.T) {
+	now := time.Date(2015, 3, 1, 23, 59, 0, 0, time.UTC)
+	limiter := testRateLimiter(&now)
+
+	for i := 0; i < 3; i++ {
+		recorder := testLimitedRequest(limiter, "/countries.json?api_key=fast", nil)
+		if recorder.Code != 200 || recorder.Header().Get("X-RateLimit-Daily-Remaining") != strconv.Itoa(2-i) {
+			t.Errorf("Wrong response %v %v", recorder.Code, recorder.Header())
+		}
+	}
+	recorder := testLimitedRequest(limiter, "/countries.json", map[string]string{"X-API-Key": "fast"})
+	if recorder.Code != 429 || recorder.Header().Get("Retry-After") != "60" || !strings.Contains(recorder.Body.String(), ErrorQuotaExceeded) {
+		t.Errorf("Wrong response %v %v: %s", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+
+	// the quota starts again the next day
+	now = now.Add(time.Minute)
+	if recorder := testLimitedRequest(limiter, "/countries.json?api_key=fast", nil); recorder.Code != 200 {
+		t.Errorf("Wrong status on the next day: %v", recorder.Code)
+	}
+
+	for i := 0; i < 10; i++ {
+		if recorder := testLimitedRequest(limiter, "/countries.json?api_key=unlimited", nil); recorder.Code != 200 ||
+			len(recorder.Header().Get("X-RateLimit-Limit")) > 0 {
+			t.Errorf("Wrong response for an unlimited key %v %v", recorder.Code, recorder.Header())
+		}
+	}
+}
+
+func Test_RateLimiter_Keys(t *testing.T) {
+	now := time.Now()
+	limiter := testRateLimiter(&now)
+
+	recorder := testLimitedRequest(limiter, "/countries.xml?api_key=wrong", nil)
+	if recorder.Code != 401 || !strings.Contains(recorder.Body.String(), "<Code>INVALID_API_KEY</Code>") {
+		t.Errorf("Wrong response %v: %s", recorder.Code, recorder.Body.String())
+	}
+
+	limiter.anonymous = nil
+	recorder = testLimitedRequest(limiter, "/countries", nil)
+	if recorder.Code != 401 || !strings.Contains(recorder.Body.String(), ErrorAPIKeyRequired) {
+		t.Errorf("Wrong response %v: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func Test_Load_RateLimitConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zilch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "keys.json")
+	ioutil.WriteFile(file, []byte(`{"Anonymous":{"RequestsPerSecond":0.5},"Keys":[{"Key":"abc","Name":"Acme","DailyQuota":1000}]}`), 0644)
+	config, err := LoadRateLimitConfig(file)
+	if err != nil || config.Anonymous.RequestsPerSecond != 0.5 || len(config.Keys) != 1 || config.Keys[0].DailyQuota != 1000 {
+		t.Errorf("Wrong config %v: %v", err, config)
+	}
+
+	ioutil.WriteFile(file, []byte(`{"Keys":[],"TrustedProxies":["10.0.0.1","10.1.0.0/16"]}`), 0644)
+	if config, err := LoadRateLimitConfig(file); err != nil || len(config.TrustedProxies) != 2 {
+		t.Errorf("Wrong config %v: %v", err, config)
+	}
+	ioutil.WriteFile(file, []byte(`{"TrustedProxies":["10.0.0.300"]}`), 0644)
+	if _, err := LoadRateLimitConfig(file); err == nil {
+		t.Error("Expected an error for an invalid trusted proxy")
+	}
+
+	ioutil.WriteFile(file, []byte(`{"Keys":[{"Name":"Acme"}]}`), 0644)
+	if _, err := LoadRateLimitConfig(file); err == nil {
+		t.Error("Expected an error for a key without a key")
+	}
+	if _, err := LoadRateLimitConfig(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
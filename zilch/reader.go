@@ -55,8 +55,19 @@ func (r ZipEntryReader) Read(ch chan ZipEntry) {
 		close(ch)
 		return
 	}
-	reader := csv.NewReader(file)
+	if err := r.readDelimited(file, ',', ch); err != nil {
+		fmt.Println("Error:", err.Error())
+	}
+}
+
+// readDelimited reads zip entries from CSV, or another delimited format, with
+// a header row naming the columns. The channel is closed at the end of the
+// input, or at the first invalid line, which is returned as an error.
+func (r ZipEntryReader) readDelimited(in io.Reader, delimiter rune, ch chan ZipEntry) error {
+	reader := csv.NewReader(in)
+	reader.Comma = delimiter
 	columns := make(map[string]int)
+	var readErr error
 
 	getVal := func(record []string, column, defaultValue string) string {
 		if colIdx, colFound := columns[column]; colFound {
@@ -92,7 +103,7 @@ func (r ZipEntryReader) Read(ch chan ZipEntry) {
 		if record, err := reader.Read(); err == io.EOF {
 			break
 		} else if err != nil {
-			fmt.Println("Error:", err.Error())
+			readErr = err
 			break
 		} else {
 			if len(columns) == 0 {
@@ -131,8 +142,14 @@ func (r ZipEntryReader) Read(ch chan ZipEntry) {
 						acceptableCities = cityList[1:]
 					}
 
+					country := getVal(record, countryCol, r.CountryCode)
+					timeZone := getVal(record, timezoneCol, "")
+					if len(timeZone) == 0 {
+						timeZone = LookupTimeZone(country, latitude, longitude)
+					}
+
 					ch <- ZipEntry{
-						ZipCode:            getVal(record, zipCodeCol, ""),
+						ZipCode:            NormalizePostalCode(country, getVal(record, zipCodeCol, "")),
 						Type:               getVal(record, typeCol, "STANDARD"),
 						City:               city,
 						AcceptableCities:   acceptableCities,
@@ -140,9 +157,9 @@ func (r ZipEntryReader) Read(ch chan ZipEntry) {
 						County:             getVal(record, countyCol, ""),
 						State:              getVal(record, stateCol, ""),
 						StateName:          getVal(record, stateNameCol, ""),
-						Country:            getVal(record, countryCol, r.CountryCode),
+						Country:            country,
 						CountryName:        getVal(record, countryNameCol, ""),
-						TimeZone:           getVal(record, timezoneCol, ""),
+						TimeZone:           timeZone,
 						AreaCodes:          areaCodes,
 						Latitude:           latitude,
 						Longitude:          longitude,
@@ -152,4 +169,5 @@ func (r ZipEntryReader) Read(ch chan ZipEntry) {
 		}
 	}
 	close(ch)
+	return readErr
 }
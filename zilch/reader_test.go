@@ -29,6 +29,9 @@ func Test_Read(t *testing.T) {
 		if entry.Country != "CA" {
 			t.Errorf("Wrong country code: %s\n", entry.Country)
 		}
+		if len(entry.TimeZone) == 0 {
+			t.Errorf("No time zone for: %s\n", entry.ZipCode)
+		}
 	}
 	if count != 1640 {
 		t.Errorf("Expecting 1640 records, found %v", count)
@@ -0,0 +1,305 @@
+package zilch
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Link is a reference from one resource to a related resource.
+type Link struct {
+	Rel  string
+	Href string
+}
+
+// Region is a navigable resource describing a country, state, county, city
+// or zip code. The Latitude and Longitude are the centroid of the zip codes
+// in the region which have coordinates, and the Coverage is the share of zip
+// codes which have coordinates.
+type Region struct {
+	Type           string
+	Code           string
+	Name           string
+	ZipCodes       uint32
+	Latitude       float32
+	Longitude      float32
+	Bounds         BoundingBox
+	Coverage       float32
+	Links          []Link
+	Children       []Region   `json:",omitempty"`
+	ZipCodeEntries []ZipEntry `json:",omitempty"`
+}
+
+// RegionSorter sorts the Region slice by name.
+type RegionSorter []Region
+
+func (r RegionSorter) Len() int      { return len(r) }
+func (r RegionSorter) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r RegionSorter) Less(i, j int) bool {
+	if r[i].Name != r[j].Name {
+		return r[i].Name < r[j].Name
+	}
+	return r[i].Code < r[j].Code
+}
+
+type regionAggregate struct {
+	code         string
+	name         string
+	zipCodes     uint32
+	located      uint32
+	latitudeSum  float64
+	longitudeSum float64
+	bounds       BoundingBox
+}
+
+type stateRegion struct {
+	regionAggregate
+	counties map[string]*regionAggregate
+	cities   map[string]*regionAggregate
+}
+
+type countryRegion struct {
+	regionAggregate
+	states map[string]*stateRegion
+}
+
+func (r *regionAggregate) add(entry ZipEntry) {
+	r.zipCodes++
+	if entry.Latitude != 0 || entry.Longitude != 0 {
+		if r.located == 0 {
+			r.bounds = BoundingBox{entry.Latitude, entry.Longitude, entry.Latitude, entry.Longitude}
+		} else {
+			r.bounds.North = float32(math.Max(float64(r.bounds.North), float64(entry.Latitude)))
+			r.bounds.South = float32(math.Min(float64(r.bounds.South), float64(entry.Latitude)))
+			r.bounds.East = float32(math.Max(float64(r.bounds.East), float64(entry.Longitude)))
+			r.bounds.West = float32(math.Min(float64(r.bounds.West), float64(entry.Longitude)))
+		}
+		r.located++
+		r.latitudeSum += float64(entry.Latitude)
+		r.longitudeSum += float64(entry.Longitude)
+	}
+}
+
+func (r regionAggregate) coverage() float32 {
+	if r.zipCodes == 0 {
+		return 0
+	}
+	return roundCoordinate(float64(r.located) / float64(r.zipCodes))
+}
+
+func (r regionAggregate) centroid() (float32, float32) {
+	if r.located == 0 {
+		return 0, 0
+	}
+	return float32(r.latitudeSum / float64(r.located)), float32(r.longitudeSum / float64(r.located))
+}
+
+func (r regionAggregate) toRegion(regionType string, links ...Link) Region {
+	lat, lon := r.centroid()
+	return Region{
+		Type:      regionType,
+		Code:      r.code,
+		Name:      r.name,
+		ZipCodes:  r.zipCodes,
+		Latitude:  lat,
+		Longitude: lon,
+		Bounds:    r.bounds,
+		Coverage:  r.coverage(),
+		Links:     links,
+	}
+}
+
+func newCountryRegion(countryCode string) *countryRegion {
+	return &countryRegion{
+		regionAggregate: regionAggregate{code: countryCode},
+		states:          make(map[string]*stateRegion),
+	}
+}
+
+func (c *countryRegion) add(entry ZipEntry) {
+	c.regionAggregate.add(entry)
+	if len(c.name) == 0 {
+		c.name = entry.CountryName
+	}
+	if len(entry.State) == 0 {
+		return
+	}
+
+	state, found := c.states[entry.State]
+	if !found {
+		state = &stateRegion{
+			regionAggregate: regionAggregate{code: entry.State, name: entry.StateName},
+			counties:        make(map[string]*regionAggregate),
+			cities:          make(map[string]*regionAggregate),
+		}
+		c.states[entry.State] = state
+	}
+	state.add(entry)
+
+	if len(entry.County) > 0 {
+		county, found := state.counties[entry.County]
+		if !found {
+			county = &regionAggregate{name: entry.County}
+			state.counties[entry.County] = county
+		}
+		county.add(entry)
+	}
+	if len(entry.City) > 0 {
+		city, found := state.cities[entry.City]
+		if !found {
+			city = &regionAggregate{name: entry.City}
+			state.cities[entry.City] = city
+		}
+		city.add(entry)
+	}
+}
+
+func (c *countryRegion) countryEntry() CountryEntry {
+	lat, lon := c.centroid()
+	countryEntry := CountryEntry{
+		Country:     c.code,
+		CountryName: c.name,
+		ZipCodes:    c.zipCodes,
+		Latitude:    lat,
+		Longitude:   lon,
+		Bounds:      c.bounds,
+		Coverage:    c.coverage(),
+		States:      make([]StateEntry, 0, len(c.states)),
+	}
+	for _, st := range c.states {
+		lat, lon := st.centroid()
+		countryEntry.States = append(countryEntry.States, StateEntry{
+			State:     st.code,
+			StateName: st.name,
+			ZipCodes:  st.zipCodes,
+			Latitude:  lat,
+			Longitude: lon,
+			Bounds:    st.bounds,
+			Coverage:  st.coverage(),
+		})
+	}
+	sort.Sort(StateSorter(countryEntry.States))
+	return countryEntry
+}
+
+func countryHref(countryCode string) string {
+	return "/countries/" + url.PathEscape(countryCode)
+}
+
+func stateHref(countryCode, state string) string {
+	return countryHref(countryCode) + "/states/" + url.PathEscape(state)
+}
+
+func (d *Database) getCountryRegion(countryCode string) (*countryRegion, error) {
+	countryCode = strings.ToUpper(countryCode)
+	if countryIndex, found := d.CountryIndexMap[countryCode]; found && countryIndex.regions != nil {
+		return countryIndex.regions, nil
+	}
+	return nil, notFoundError(ErrorCountryNotFound, "No country %s found", countryCode)
+}
+
+func (d *Database) getStateRegion(countryCode, state string) (*countryRegion, *stateRegion, error) {
+	country, err := d.getCountryRegion(countryCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st, found := country.states[strings.ToUpper(state)]; found {
+		return country, st, nil
+	}
+	return nil, nil, notFoundError(ErrorStateNotFound, "No state %s found in %s", state, country.code)
+}
+
+// GetCountryRegion gets the country, with its states as children.
+func (d *Database) GetCountryRegion(countryCode string) (Region, error) {
+	country, err := d.getCountryRegion(countryCode)
+	if err != nil {
+		return Region{}, err
+	}
+	region := country.toRegion("Country",
+		Link{"self", countryHref(country.code)},
+		Link{"countries", "/countries"},
+		Link{"zipcodes", "/query?Country=" + url.QueryEscape(country.code)})
+
+	region.Children = make([]Region, 0, len(country.states))
+	for _, st := range country.states {
+		region.Children = append(region.Children, st.toRegion("State",
+			Link{"self", stateHref(country.code, st.code)}))
+	}
+	sort.Sort(RegionSorter(region.Children))
+	return region, nil
+}
+
+// GetStateRegion gets a state, with links to its counties and cities.
+func (d *Database) GetStateRegion(countryCode, state string) (Region, error) {
+	country, st, err := d.getStateRegion(countryCode, state)
+	if err != nil {
+		return Region{}, err
+	}
+	href := stateHref(country.code, st.code)
+	return st.toRegion("State",
+		Link{"self", href},
+		Link{"country", countryHref(country.code)},
+		Link{"counties", href + "/counties"},
+		Link{"cities", href + "/cities"},
+		Link{"zipcodes", "/query?Country=" + url.QueryEscape(country.code) + "&State=" + url.QueryEscape(st.code)}), nil
+}
+
+// GetCountyRegions gets a state, with its counties as children.
+func (d *Database) GetCountyRegions(countryCode, state string) (Region, error) {
+	return d.getStateChildren(countryCode, state, "County")
+}
+
+// GetCityRegions gets a state, with its cities as children.
+func (d *Database) GetCityRegions(countryCode, state string) (Region, error) {
+	return d.getStateChildren(countryCode, state, "City")
+}
+
+func (d *Database) getStateChildren(countryCode, state, childType string) (Region, error) {
+	country, st, err := d.getStateRegion(countryCode, state)
+	if err != nil {
+		return Region{}, err
+	}
+	region, _ := d.GetStateRegion(country.code, st.code)
+
+	children := st.cities
+	if childType == "County" {
+		children = st.counties
+	}
+	query := "/query?Country=" + url.QueryEscape(country.code) + "&State=" + url.QueryEscape(st.code)
+	region.Children = make([]Region, 0, len(children))
+	for name, child := range children {
+		region.Children = append(region.Children, child.toRegion(childType,
+			Link{"zipcodes", query + "&Exact" + childType + "=" + url.QueryEscape(name)}))
+	}
+	sort.Sort(RegionSorter(region.Children))
+	return region, nil
+}
+
+// GetZipCodeRegion gets the entries for a single zip code, with links to
+// the state and country they are in.
+func (d *Database) GetZipCodeRegion(countryCode, zipCode string) (Region, error) {
+	country, err := d.getCountryRegion(countryCode)
+	if err != nil {
+		return Region{}, err
+	}
+	entries := d.CountryIndexMap[country.code].findZipCode(zipCode)
+	if len(entries) == 0 {
+		return Region{}, notFoundError(ErrorZipCodeNotFound, "No zip code %s found in %s", zipCode, country.code)
+	}
+
+	aggregate := regionAggregate{code: entries[0].ZipCode, name: entries[0].City}
+	for _, entry := range entries {
+		aggregate.add(entry)
+	}
+	links := []Link{
+		Link{"self", "/zip/" + url.PathEscape(country.code) + "/" + url.PathEscape(aggregate.code)},
+		Link{"country", countryHref(country.code)},
+	}
+	if len(entries[0].State) > 0 {
+		links = append(links, Link{"state", stateHref(country.code, entries[0].State)})
+	}
+	region := aggregate.toRegion("ZipCode", links...)
+	region.ZipCodeEntries = entries
+	return region, nil
+}
@@ -0,0 +1,142 @@
+package zilch
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func testRegionDatabase() *Database {
+	entries := []ZipEntry{
+		ZipEntry{ZipCode: "22151", City: "Springfield", County: "Fairfax", State: "VA", StateName: "Virginia", Country: "US", CountryName: "United States", Latitude: 38, Longitude: -77},
+		ZipEntry{ZipCode: "22152", City: "Springfield", County: "Fairfax", State: "VA", StateName: "Virginia", Country: "US", CountryName: "United States", Latitude: 40, Longitude: -79},
+		ZipEntry{ZipCode: "23219", City: "Richmond", County: "Richmond City", State: "VA", StateName: "Virginia", Country: "US", CountryName: "United States"},
+		ZipEntry{ZipCode: "62701", City: "Springfield", County: "Sangamon", State: "IL", StateName: "Illinois", Country: "US", CountryName: "United States", Latitude: 39.8, Longitude: -89.6},
+	}
+	regions := newCountryRegion("US")
+	for _, entry := range entries {
+		regions.add(entry)
+	}
+	index := CountryIndex{CountryCode: "US", Entries: entries, regions: regions}
+	index.buildZipIndex()
+	return &Database{CountryIndexMap: map[string]CountryIndex{"US": index}}
+}
+
+func Test_CountryRegion(t *testing.T) {
+	database := testRegionDatabase()
+
+	country, err := database.GetCountryRegion("us")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if country.ZipCodes != 4 || country.Name != "United States" || len(country.Children) != 2 {
+		t.Errorf("Wrong country: %v", country)
+	} else if country.Children[0].Code != "IL" || country.Children[1].ZipCodes != 3 || country.Children[1].Links[0].Href != "/countries/US/states/VA" {
+		t.Errorf("Wrong states: %v", country.Children)
+	}
+
+	entry := database.CountryIndexMap["US"].regions.countryEntry()
+	if len(entry.States) != 2 || entry.States[0].State != "IL" || entry.States[1].ZipCodes != 3 {
+		t.Errorf("Wrong country entry: %v", entry)
+	}
+	if entry.ZipCodes != 4 || entry.Coverage != 0.75 || entry.Bounds != (BoundingBox{40, -89.6, 38, -77}) {
+		t.Errorf("Wrong country geography: %v", entry)
+	}
+	if entry.States[0].Latitude != 39.8 || entry.States[0].Bounds != (BoundingBox{39.8, -89.6, 39.8, -89.6}) || entry.States[0].Coverage != 1 {
+		t.Errorf("Wrong state geography: %v", entry.States[0])
+	}
+
+	if _, err := database.GetCountryRegion("XX"); err == nil {
+		t.Error("Expected an error for an unknown country")
+	}
+}
+
+func Test_StateRegion(t *testing.T) {
+	database := testRegionDatabase()
+
+	state, err := database.GetStateRegion("US", "va")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if state.ZipCodes != 3 || state.Latitude != 39 || state.Longitude != -78 {
+		t.Errorf("Wrong state centroid: %v", state)
+	}
+	if state.Bounds != (BoundingBox{40, -79, 38, -77}) || state.Coverage != 0.6667 {
+		t.Errorf("Wrong state bounds: %v, %v", state.Bounds, state.Coverage)
+	}
+	if len(state.Links) != 5 || state.Links[2].Href != "/countries/US/states/VA/counties" {
+		t.Errorf("Wrong state links: %v", state.Links)
+	}
+
+	counties, err := database.GetCountyRegions("US", "VA")
+	if err != nil {
+		t.Error(err)
+	} else if len(counties.Children) != 2 || counties.Children[0].Name != "Fairfax" || counties.Children[0].ZipCodes != 2 {
+		t.Errorf("Wrong counties: %v", counties.Children)
+	} else if counties.Children[1].Links[0].Href != "/query?Country=US&State=VA&ExactCounty=Richmond+City" {
+		t.Errorf("Wrong county link: %v", counties.Children[1].Links)
+	}
+
+	cities, err := database.GetCityRegions("US", "VA")
+	if err != nil {
+		t.Error(err)
+	} else if len(cities.Children) != 2 || cities.Children[1].Name != "Springfield" || cities.Children[1].ZipCodes != 2 {
+		t.Errorf("Wrong cities: %v", cities.Children)
+	}
+
+	if _, err := database.GetStateRegion("US", "PA"); err == nil {
+		t.Error("Expected an error for an unknown state")
+	}
+}
+
+func Test_ZipCodeRegion(t *testing.T) {
+	database := testRegionDatabase()
+
+	zip, err := database.GetZipCodeRegion("US", "62701")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if zip.Name != "Springfield" || len(zip.ZipCodeEntries) != 1 || zip.Links[2].Href != "/countries/US/states/IL" {
+		t.Errorf("Wrong zip code: %v", zip)
+	}
+
+	if yaml, err := zip.Marshal("YAML"); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(yaml, "ZipCodeEntries:\n  - ZipCode:             \"62701\"\n") {
+		t.Errorf("Wrong YAML: %s", yaml)
+	}
+
+	if _, err := database.GetZipCodeRegion("US", "99999"); err == nil {
+		t.Error("Expected an error for an unknown zip code")
+	}
+}
+
+func Test_Region_Links(t *testing.T) {
+	entries := []ZipEntry{
+		ZipEntry{ZipCode: "33901", City: "Fort Myers", County: "Lee", State: "FL", Country: "US"},
+		ZipEntry{ZipCode: "33902", City: "Fort Myers Beach", County: "Leesburg", State: "FL", Country: "US"},
+		ZipEntry{ZipCode: "33903", City: "Fort Myers Beach", County: "Leesburg", State: "FL", Country: "US"},
+	}
+	regions := newCountryRegion("US")
+	for _, entry := range entries {
+		regions.add(entry)
+	}
+	database := &Database{CountryIndexMap: map[string]CountryIndex{"US": CountryIndex{CountryCode: "US", Entries: entries, regions: regions}}}
+
+	// each child's link finds exactly the zip codes it counts
+	counties, _ := database.GetCountyRegions("US", "FL")
+	cities, _ := database.GetCityRegions("US", "FL")
+	for _, child := range append(counties.Children, cities.Children...) {
+		link, _ := url.Parse(child.Links[0].Href)
+		query := make(map[string]string)
+		for key := range link.Query() {
+			query[key] = link.Query().Get(key)
+		}
+		if result, err := database.ExecQuery(query); err != nil || result.TotalFound != int(child.ZipCodes) {
+			t.Errorf("Link %v found %v zip codes, expected %v: %v", link, result.TotalFound, child.ZipCodes, err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/hoisie/web"
@@ -35,12 +36,23 @@ func (c StaticController) RenderJS(ctx *web.Context, jsFile string) {
 }
 
 func (c StaticController) renderContent(ctx *web.Context, contentType, filepath string) {
-	if file, err := os.Open(filepath); err != nil {
-		w := ResponseWriter{ctx, "HTML"}
+	w := ResponseWriter{ctx, "HTML"}
+	file, err := os.Open(filepath)
+	if err != nil {
 		w.SendError(err)
-	} else {
-		ctx.ContentType(contentType + "; charset=utf-8")
-		reader := bufio.NewReader(file)
-		io.Copy(ctx.ResponseWriter, reader)
+		return
 	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		w.SendError(err)
+		return
+	}
+	if w.notModified(strconv.FormatInt(info.Size(), 36)+"-"+strconv.FormatInt(info.ModTime().UnixNano(), 36), info.ModTime()) {
+		return
+	}
+	ctx.ContentType(contentType + "; charset=utf-8")
+	reader := bufio.NewReader(file)
+	io.Copy(ctx.ResponseWriter, reader)
 }
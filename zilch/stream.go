@@ -0,0 +1,231 @@
+package zilch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// streamFormats are the formats of a streamed query response.
+var streamFormats = []string{"JSON", "NDJSON", "CSV", "TSV"}
+
+// StreamQuery finds the zip codes matching the query filters like
+// ExecQuery, but passes each one to the callback as soon as it is found
+// instead of collecting them, so that any number of zip codes can be
+// returned with bounded memory. The zip codes are neither sorted nor paged,
+// and the countries are streamed in order of their code. The stream stops at
+// the first error returned by the callback.
+func (d *Database) StreamQuery(queryParams map[string]string, callback func(ZipEntry) error) error {
+	if !HasQueryFilters(queryParams) {
+		return badRequestError(ErrorMissingParameter, "There are no query filters")
+	}
+	if err := validateQueryFilters(queryParams); err != nil {
+		return err
+	}
+
+	countries := make([]string, 0, len(d.CountryIndexMap))
+	if country, found := queryParams["Country"]; found {
+		if _, found := d.CountryIndexMap[country]; !found {
+			return notFoundError(ErrorCountryNotFound, "No country %s found", country)
+		}
+		countries = append(countries, country)
+	} else {
+		for country := range d.CountryIndexMap {
+			countries = append(countries, country)
+		}
+		sort.Strings(countries)
+	}
+
+	localTime := queryParams["localtime"] == "true"
+	now := time.Now()
+	for _, country := range countries {
+		ch := make(chan ZipEntry)
+		go d.CountryIndexMap[country].QueryIndex(queryParams, ch)
+
+		var err error
+		for entry := range ch {
+			// keep draining the channel after an error, so that the query
+			// of the index can finish
+			if err != nil {
+				continue
+			}
+			if localTime {
+				entry.LocalTime = GetLocalTime(entry.TimeZone, now)
+			}
+			err = callback(entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryStreamer writes zip entries to an io.Writer one at a time.
+type entryStreamer interface {
+	begin() error
+	write(entry ZipEntry) error
+	end() error
+}
+
+// newEntryStreamer creates the entry streamer for one of the streamFormats.
+func newEntryStreamer(format string, w io.Writer) (entryStreamer, error) {
+	switch strings.ToUpper(format) {
+	case "NDJSON":
+		return &ndjsonStreamer{json.NewEncoder(w)}, nil
+	case "JS", "JSON":
+		return &jsonArrayStreamer{w: w}, nil
+	case "CSV":
+		return newDelimitedStreamer(w, ','), nil
+	case "TSV":
+		return newDelimitedStreamer(w, '\t'), nil
+	}
+	return nil, invalidFormatError(strings.ToUpper(format))
+}
+
+// ndjsonStreamer writes each entry as a JSON object on its own line.
+type ndjsonStreamer struct {
+	enc *json.Encoder
+}
+
+func (s *ndjsonStreamer) begin() error               { return nil }
+func (s *ndjsonStreamer) write(entry ZipEntry) error { return s.enc.Encode(&entry) }
+func (s *ndjsonStreamer) end() error                 { return nil }
+
+// jsonArrayStreamer writes the entries as a single JSON array.
+type jsonArrayStreamer struct {
+	w       io.Writer
+	entries int
+}
+
+func (s *jsonArrayStreamer) begin() error {
+	_, err := io.WriteString(s.w, "[")
+	return err
+}
+
+func (s *jsonArrayStreamer) write(entry ZipEntry) error {
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	if s.entries > 0 {
+		if _, err := io.WriteString(s.w, ","); err != nil {
+			return err
+		}
+	}
+	s.entries++
+	_, err = s.w.Write(data)
+	return err
+}
+
+func (s *jsonArrayStreamer) end() error {
+	_, err := io.WriteString(s.w, "]\n")
+	return err
+}
+
+// delimitedStreamer writes the entries as rows of delimitedColumns, the same
+// as the CSV and TSV query responses.
+type delimitedStreamer struct {
+	w *csv.Writer
+}
+
+func newDelimitedStreamer(w io.Writer, delimiter rune) *delimitedStreamer {
+	s := &delimitedStreamer{csv.NewWriter(w)}
+	s.w.Comma = delimiter
+	return s
+}
+
+func (s *delimitedStreamer) begin() error {
+	return s.w.Write(delimitedColumns)
+}
+
+func (s *delimitedStreamer) write(entry ZipEntry) error {
+	return s.w.Write(entry.toRecord())
+}
+
+func (s *delimitedStreamer) end() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// isStreamRequest determines whether the query should be streamed, which is
+// when the format is NDJSON or the "stream" parameter is "true".
+func (writer ResponseWriter) isStreamRequest() bool {
+	return strings.EqualFold(writer.format, "NDJSON") || writer.ctx.Request.FormValue("stream") == "true"
+}
+
+// SendQueryStream streams the zip codes matching the query straight onto the
+// response, which is gzipped when the client accepts it. Errors found before
+// the first zip code are sent as usual, while a failure part way through
+// ends the response early.
+func (writer ResponseWriter) SendQueryStream(database *Database, queryParams map[string]string) {
+	format, ok := writer.getFormat(streamFormats)
+	if !ok {
+		return
+	}
+	if _, err := newEntryStreamer(format, nil); err != nil {
+		writer.SendError(err)
+		return
+	}
+
+	var out io.Writer = writer.ctx.ResponseWriter
+	var gzw *gzip.Writer
+	var buf *bufio.Writer
+	var streamer entryStreamer
+
+	// the response is only started once the first zip code has been found,
+	// so that an invalid query still gets an error status
+	start := func() error {
+		f, _ := lookupFormat(format)
+		writer.ctx.ContentType(f.contentType())
+		if f.Attachment {
+			writer.setAttachment(streamFileName(queryParams, f.Extensions[0]))
+		}
+		if strings.Index(writer.ctx.Request.Header.Get("Accept-encoding"), "gzip") != -1 {
+			writer.ctx.ResponseWriter.Header().Add("Content-encoding", "gzip")
+			gzw = gzip.NewWriter(out)
+			out = gzw
+		}
+		buf = bufio.NewWriter(out)
+		streamer, _ = newEntryStreamer(format, buf)
+		return streamer.begin()
+	}
+
+	err := database.StreamQuery(queryParams, func(entry ZipEntry) error {
+		if streamer == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return streamer.write(entry)
+	})
+	if streamer == nil {
+		if err != nil {
+			writer.SendError(err)
+			return
+		}
+		err = start()
+	}
+	// once the response has started an error can only cut it short
+	if err == nil {
+		streamer.end()
+	}
+	buf.Flush()
+	if gzw != nil {
+		gzw.Close()
+	}
+}
+
+// streamFileName gets the name of a streamed CSV or TSV file, named after
+// the country when the query is for a single country.
+func streamFileName(queryParams map[string]string, extension string) string {
+	if country, found := queryParams["Country"]; found {
+		return strings.ToLower(country) + "_zip_code_database." + extension
+	}
+	return "zip_codes." + extension
+}
@@ -0,0 +1,145 @@
+package zilch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func testStreamDatabase(size int) *Database {
+	entries := make([]ZipEntry, size)
+	for i := range entries {
+		entries[i] = ZipEntry{ZipCode: fmt.Sprintf("%05d", i), City: "Springfield", State: "VA", Country: "US", AcceptableCities: []string{}, UnacceptableCities: []string{}, AreaCodes: []string{"703"}}
+	}
+	index := CountryIndex{CountryCode: "US", Entries: entries}
+	return &Database{CountryIndexMap: map[string]CountryIndex{"US": index}, FullyLoaded: true}
+}
+
+func Test_StreamQuery(t *testing.T) {
+	database := testRegionDatabase()
+
+	found := make([]string, 0)
+	err := database.StreamQuery(map[string]string{"State": "VA"}, func(entry ZipEntry) error {
+		found = append(found, entry.ZipCode)
+		return nil
+	})
+	if err != nil || strings.Join(found, ",") != "22151,22152,23219" {
+		t.Errorf("Wrong stream %v: %v", err, found)
+	}
+
+	tests := []struct {
+		params map[string]string
+		code   string
+	}{
+		{map[string]string{"stream": "true"}, ErrorMissingParameter},
+		{map[string]string{"Country": "XX"}, ErrorCountryNotFound},
+		{map[string]string{"Country": "US", "Type": "BOGUS"}, ErrorInvalidParameter},
+	}
+	for _, test := range tests {
+		err := database.StreamQuery(test.params, func(entry ZipEntry) error { return nil })
+		if err == nil || toError(err).Code != test.code {
+			t.Errorf("Wrong error for %v: %v", test.params, err)
+		}
+	}
+
+	calls := 0
+	err = database.StreamQuery(map[string]string{"Country": "US"}, func(entry ZipEntry) error {
+		calls++
+		return errors.New("Closed")
+	})
+	if err == nil || err.Error() != "Closed" || calls != 1 {
+		t.Errorf("Expected the stream to stop after %v calls: %v", calls, err)
+	}
+}
+
+func Test_Entry_Streamers(t *testing.T) {
+	q := testUnmarshalQueryResult()
+
+	for _, format := range []string{"CSV", "TSV", "JSON", "NDJSON"} {
+		buf := bytes.Buffer{}
+		streamer, err := newEntryStreamer(format, &buf)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		streamer.begin()
+		for _, entry := range q.ZipCodeEntries {
+			streamer.write(entry)
+		}
+		streamer.end()
+
+		var expected string
+		switch format {
+		case "CSV":
+			expected, _ = q.toDelimited(',')
+		case "TSV":
+			expected, _ = q.toDelimited('\t')
+		case "JSON":
+			data, _ := json.Marshal(q.ZipCodeEntries)
+			expected = string(data) + "\n"
+		case "NDJSON":
+			for _, entry := range q.ZipCodeEntries {
+				data, _ := json.Marshal(entry)
+				expected += string(data) + "\n"
+			}
+		}
+		if buf.String() != expected {
+			t.Errorf("Wrong %s stream\nFound:\n%s\nExpecting:\n%s", format, buf.String(), expected)
+		}
+	}
+
+	if _, err := newEntryStreamer("XML", nil); err == nil {
+		t.Error("Expected an error for XML")
+	}
+}
+
+func Test_ResponseWriter_SendQueryStream(t *testing.T) {
+	database := testStreamDatabase(450)
+
+	writer, recorder := testResponseWriter("ndjson", "")
+	writer.SendQueryStream(database, map[string]string{"Country": "US"})
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	if recorder.Code != 200 || recorder.Header().Get("Content-Type") != "application/x-ndjson; charset=utf-8" || len(lines) != 450 {
+		t.Errorf("Wrong NDJSON stream %v %v: %v lines", recorder.Code, recorder.Header(), len(lines))
+	}
+
+	writer, recorder = testResponseWriter("csv", "")
+	writer.ctx.Request.Header.Set("Accept-Encoding", "gzip")
+	writer.SendQueryStream(database, map[string]string{"Country": "US"})
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, _ := ioutil.ReadAll(reader)
+	lines = strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 451 || lines[0] != strings.Join(delimitedColumns, ",") ||
+		recorder.Header().Get("Content-Disposition") != `attachment; filename="us_zip_code_database.csv"` {
+		t.Errorf("Wrong CSV stream %v: %v lines", recorder.Header(), len(lines))
+	}
+
+	// without an extension the stream is a JSON array, which is empty when
+	// nothing matches
+	writer, recorder = testResponseWriter("", "")
+	writer.SendQueryStream(database, map[string]string{"Country": "US", "City": "Nowhere"})
+	if recorder.Code != 200 || recorder.Body.String() != "[]\n" {
+		t.Errorf("Wrong empty stream %v: %s", recorder.Code, recorder.Body.String())
+	}
+
+	writer, recorder = testResponseWriter("json", "")
+	writer.SendQueryStream(database, map[string]string{"Country": "XX"})
+	if recorder.Code != 404 || !strings.Contains(recorder.Body.String(), ErrorCountryNotFound) {
+		t.Errorf("Wrong error %v: %s", recorder.Code, recorder.Body.String())
+	}
+
+	writer, recorder = testResponseWriter("yaml", "")
+	writer.SendQueryStream(database, map[string]string{"Country": "US"})
+	if recorder.Code != 400 || !strings.Contains(recorder.Body.String(), ErrorInvalidFormat) {
+		t.Errorf("Wrong error %v: %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,143 @@
+package zilch
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSuggestions int = 10
+	maxSuggestions     int = 50
+)
+
+// Suggestion is a single typeahead match for a partial query. The Type is
+// one of City, State or ZipCode, and the Entry is a representative zip code
+// for the suggested value.
+type Suggestion struct {
+	Text     string
+	Type     string
+	ZipCodes int
+	Entry    ZipEntry
+	prefix   bool
+}
+
+// SuggestionMarshaller is used to marshal Suggestion objects.
+type SuggestionMarshaller []Suggestion
+
+// SuggestionSorter sorts the Suggestion slice, putting prefix matches first,
+// followed by the suggestions with the most zip codes.
+type SuggestionSorter []Suggestion
+
+func (s SuggestionSorter) Len() int      { return len(s) }
+func (s SuggestionSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s SuggestionSorter) Less(i, j int) bool {
+	if s[i].prefix != s[j].prefix {
+		return s[i].prefix
+	}
+	if s[i].ZipCodes != s[j].ZipCodes {
+		return s[i].ZipCodes > s[j].ZipCodes
+	}
+	if s[i].Text != s[j].Text {
+		return s[i].Text < s[j].Text
+	}
+	return s[i].Entry.Country < s[j].Entry.Country
+}
+
+// Suggest finds a short ranked list of city names, state names and zip codes
+// matching the partial text in the "q" query parameter.
+func (d *Database) Suggest(queryParams map[string]string) ([]Suggestion, error) {
+	q := strings.ToLower(strings.TrimSpace(queryParams["q"]))
+	if len(q) == 0 {
+		return nil, badRequestError(ErrorMissingParameter, "There is no suggestion query")
+	}
+
+	limit := defaultSuggestions
+	if l, found := queryParams["limit"]; found {
+		pl, err := strconv.ParseUint(l, 10, 32)
+		if err != nil {
+			return nil, badRequestError(ErrorInvalidParameter, "Invalid limit: %s", l)
+		}
+		limit = int(pl)
+		if limit > maxSuggestions {
+			limit = maxSuggestions
+		}
+	}
+
+	indexes := make([]CountryIndex, 0, len(d.CountryIndexMap))
+	if country, found := queryParams["Country"]; found {
+		countryIndex, indexFound := d.CountryIndexMap[country]
+		if !indexFound {
+			return nil, notFoundError(ErrorCountryNotFound, "No country %s found", country)
+		}
+		indexes = append(indexes, countryIndex)
+	} else {
+		for _, countryIndex := range d.CountryIndexMap {
+			indexes = append(indexes, countryIndex)
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, limit)
+	for _, countryIndex := range indexes {
+		suggestions = append(suggestions, countryIndex.suggest(q)...)
+	}
+	sort.Sort(SuggestionSorter(suggestions))
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+var suggestZipCleaner = regexp.MustCompile("[^0-9A-Za-z]")
+
+func (c CountryIndex) suggest(q string) []Suggestion {
+	zipQuery := suggestZipCleaner.ReplaceAllString(q, "")
+
+	cities := make(map[string]*Suggestion)
+	states := make(map[string]*Suggestion)
+	zipCodes := make(map[string]*Suggestion)
+
+	add := func(group map[string]*Suggestion, key, text, suggestionType string, prefix bool, entry ZipEntry) {
+		if s, found := group[key]; found {
+			s.ZipCodes++
+		} else {
+			group[key] = &Suggestion{
+				Text:     text,
+				Type:     suggestionType,
+				ZipCodes: 1,
+				Entry:    entry,
+				prefix:   prefix,
+			}
+		}
+	}
+
+	for _, entry := range c.Entries {
+		city := strings.ToLower(entry.City)
+		if idx := strings.Index(city, q); idx != -1 {
+			add(cities, entry.State+"|"+city, entry.City, "City", idx == 0, entry)
+		}
+
+		stateName := strings.ToLower(entry.StateName)
+		if idx := strings.Index(stateName, q); idx != -1 {
+			add(states, entry.State, entry.StateName, "State", idx == 0, entry)
+		} else if strings.ToLower(entry.State) == q {
+			add(states, entry.State, entry.StateName, "State", true, entry)
+		}
+
+		if len(zipQuery) > 0 {
+			zipCode := strings.ToLower(suggestZipCleaner.ReplaceAllString(entry.ZipCode, ""))
+			if strings.Index(zipCode, zipQuery) == 0 {
+				add(zipCodes, entry.ZipCode, entry.ZipCode, "ZipCode", true, entry)
+			}
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(cities)+len(states)+len(zipCodes))
+	for _, group := range []map[string]*Suggestion{cities, states, zipCodes} {
+		for _, s := range group {
+			suggestions = append(suggestions, *s)
+		}
+	}
+	return suggestions
+}
@@ -0,0 +1,84 @@
+package zilch
+
+import (
+	"testing"
+)
+
+func Test_Suggest(t *testing.T) {
+	database := &Database{
+		CountryIndexMap: map[string]CountryIndex{
+			"US": CountryIndex{
+				CountryCode: "US",
+				Entries: []ZipEntry{
+					ZipEntry{ZipCode: "22151", City: "Springfield", State: "VA", StateName: "Virginia", Country: "US"},
+					ZipEntry{ZipCode: "62701", City: "Springfield", State: "IL", StateName: "Illinois", Country: "US"},
+					ZipEntry{ZipCode: "62702", City: "Springfield", State: "IL", StateName: "Illinois", Country: "US"},
+					ZipEntry{ZipCode: "62703", City: "Springfield", State: "IL", StateName: "Illinois", Country: "US"},
+					ZipEntry{ZipCode: "16066", City: "Cranberry Springs", State: "PA", StateName: "Pennsylvania", Country: "US"},
+				},
+			},
+		},
+	}
+
+	suggestions, err := database.Suggest(map[string]string{"q": "Spri", "Country": "US"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(suggestions) != 3 {
+		t.Errorf("Expected 3 suggestions, found %v", suggestions)
+		return
+	}
+	if suggestions[0].Entry.State != "IL" || suggestions[0].ZipCodes != 3 || suggestions[0].Type != "City" {
+		t.Errorf("Largest prefix match should be first: %v", suggestions[0])
+	}
+	if suggestions[1].Entry.State != "VA" || suggestions[1].ZipCodes != 1 {
+		t.Errorf("Smaller prefix match should be second: %v", suggestions[1])
+	}
+	if suggestions[2].Text != "Cranberry Springs" {
+		t.Errorf("Partial match should be last: %v", suggestions[2])
+	}
+
+	if suggestions, err = database.Suggest(map[string]string{"q": "627", "limit": "2"}); err != nil {
+		t.Error(err)
+	} else if len(suggestions) != 2 || suggestions[0].Type != "ZipCode" || suggestions[0].Text != "62701" {
+		t.Errorf("Wrong zip code suggestions: %v", suggestions)
+	}
+
+	if suggestions, err = database.Suggest(map[string]string{"q": "illi"}); err != nil {
+		t.Error(err)
+	} else if len(suggestions) != 1 || suggestions[0].Type != "State" || suggestions[0].ZipCodes != 3 {
+		t.Errorf("Wrong state suggestions: %v", suggestions)
+	}
+
+	if _, err = database.Suggest(map[string]string{"Country": "US"}); err == nil {
+		t.Error("Expected an error for a missing query")
+	}
+	if _, err = database.Suggest(map[string]string{"q": "Spri", "limit": "ten"}); toError(err).Status != 400 || toError(err).Code != ErrorInvalidParameter {
+		t.Errorf("Expected a bad request for an invalid limit: %v", err)
+	}
+}
+
+func Test_Suggestion_Marshal_YAML(t *testing.T) {
+	s := SuggestionMarshaller{{
+		Text:     "Springfield",
+		Type:     "City",
+		ZipCodes: 1,
+		Entry: ZipEntry{ZipCode: "22151", City: "Springfield", Country: "US",
+			LocalTime: &LocalTimeInfo{UTCOffset: "-05:00", LocalTime: "2015-03-01T07:00:00-05:00"}},
+	}}
+	data, err := s.Marshal("YAML")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseYAML(data)
+	if err != nil {
+		t.Fatalf("Invalid YAML %v:\n%s", err, data)
+	}
+	suggestion := parsed.(map[string]interface{})["Suggestions"].([]interface{})[0].(map[string]interface{})
+	entry := suggestion["Entry"].(map[string]interface{})
+	localTime := entry["LocalTime"].(map[string]interface{})
+	if suggestion["Text"] != "Springfield" || entry["ZipCode"] != "22151" || entry["Country"] != "US" || localTime["UTCOffset"] != "-05:00" {
+		t.Errorf("Wrong YAML:\n%s", data)
+	}
+}
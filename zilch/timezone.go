@@ -0,0 +1,287 @@
+package zilch
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	// embed the time zone database, so that zones can be resolved on
+	// hosts without one, which needs Go 1.15
+	_ "time/tzdata"
+)
+
+// LocalTimeInfo is the current time in the time zone of a zip code.
+type LocalTimeInfo struct {
+	UTCOffset        string
+	UTCOffsetSeconds int
+	DST              bool
+	LocalTime        string
+}
+
+type zoneReference struct {
+	zone      string
+	latitude  float64
+	longitude float64
+}
+
+// countryTimeZones are the time zones of the countries which only have one.
+var countryTimeZones = map[string]string{
+	"AR": "America/Argentina/Buenos_Aires",
+	"DE": "Europe/Berlin",
+	"FR": "Europe/Paris",
+	"GB": "Europe/London",
+	"IN": "Asia/Kolkata",
+	"IT": "Europe/Rome",
+	"JP": "Asia/Tokyo",
+	"NL": "Europe/Amsterdam",
+	"ZA": "Africa/Johannesburg",
+}
+
+// zoneReferences are the reference points of the countries with more than
+// one time zone. A zip code takes the zone of the nearest reference point,
+// and the first reference point is used for zip codes without coordinates.
+var zoneReferences = map[string][]zoneReference{
+	"AU": []zoneReference{
+		{"Australia/Sydney", -33.87, 151.21},
+		{"Australia/Sydney", -32.93, 151.78},
+		{"Australia/Sydney", -35.28, 149.13},
+		{"Australia/Broken_Hill", -31.95, 141.45},
+		{"Australia/Melbourne", -37.81, 144.96},
+		{"Australia/Melbourne", -36.76, 144.28},
+		{"Australia/Hobart", -42.88, 147.33},
+		{"Australia/Hobart", -41.44, 147.14},
+		{"Australia/Brisbane", -27.47, 153.03},
+		{"Australia/Brisbane", -19.26, 146.82},
+		{"Australia/Brisbane", -16.92, 145.77},
+		{"Australia/Brisbane", -20.73, 139.49},
+		{"Australia/Brisbane", -26.41, 146.24},
+		{"Australia/Adelaide", -34.93, 138.6},
+		{"Australia/Adelaide", -30.0, 136.0},
+		{"Australia/Adelaide", -26.6, 135.0},
+		{"Australia/Darwin", -12.46, 130.84},
+		{"Australia/Darwin", -23.7, 133.88},
+		{"Australia/Darwin", -19.65, 134.19},
+		{"Australia/Perth", -31.95, 115.86},
+		{"Australia/Perth", -20.31, 118.58},
+		{"Australia/Perth", -30.75, 121.47},
+		{"Australia/Perth", -17.96, 122.24},
+		{"Australia/Perth", -25.0, 127.0},
+		{"Australia/Eucla", -31.68, 128.88},
+		{"Australia/Lord_Howe", -31.55, 159.08},
+	},
+	"BR": []zoneReference{
+		{"America/Sao_Paulo", -23.55, -46.63},
+		{"America/Sao_Paulo", -22.91, -43.17},
+		{"America/Sao_Paulo", -19.92, -43.94},
+		{"America/Sao_Paulo", -15.79, -47.88},
+		{"America/Sao_Paulo", -16.68, -49.25},
+		{"America/Sao_Paulo", -25.43, -49.27},
+		{"America/Sao_Paulo", -27.6, -48.55},
+		{"America/Sao_Paulo", -30.03, -51.23},
+		{"America/Sao_Paulo", -20.32, -40.34},
+		{"America/Bahia", -12.97, -38.5},
+		{"America/Bahia", -12.0, -44.0},
+		{"America/Maceio", -9.67, -35.74},
+		{"America/Maceio", -10.91, -37.07},
+		{"America/Recife", -8.05, -34.9},
+		{"America/Recife", -7.12, -34.86},
+		{"America/Fortaleza", -3.73, -38.52},
+		{"America/Fortaleza", -5.79, -35.21},
+		{"America/Fortaleza", -5.09, -42.8},
+		{"America/Fortaleza", -2.53, -44.3},
+		{"America/Araguaina", -10.18, -48.33},
+		{"America/Araguaina", -7.19, -48.2},
+		{"America/Belem", -1.46, -48.5},
+		{"America/Belem", 0.03, -51.07},
+		{"America/Santarem", -2.44, -54.71},
+		{"America/Manaus", -3.1, -60.02},
+		{"America/Manaus", -5.0, -65.0},
+		{"America/Boa_Vista", 2.82, -60.67},
+		{"America/Porto_Velho", -8.76, -63.9},
+		{"America/Rio_Branco", -9.97, -67.81},
+		{"America/Cuiaba", -15.6, -56.1},
+		{"America/Cuiaba", -11.86, -55.5},
+		{"America/Campo_Grande", -20.44, -54.65},
+		{"America/Campo_Grande", -22.22, -54.81},
+		{"America/Noronha", -3.85, -32.42},
+	},
+	"CA": []zoneReference{
+		{"America/Toronto", 43.65, -79.38},
+		{"America/Toronto", 45.42, -75.7},
+		{"America/Toronto", 45.5, -73.57},
+		{"America/Toronto", 46.81, -71.21},
+		{"America/Toronto", 46.49, -80.99},
+		{"America/Toronto", 48.38, -89.25},
+		{"America/Toronto", 50.2, -66.38},
+		{"America/Toronto", 53.0, -77.0},
+		{"America/Halifax", 44.65, -63.57},
+		{"America/Halifax", 46.09, -64.78},
+		{"America/Halifax", 45.27, -66.06},
+		{"America/Halifax", 46.24, -63.13},
+		{"America/Moncton", 47.62, -65.65},
+		{"America/Goose_Bay", 53.3, -60.42},
+		{"America/St_Johns", 47.56, -52.71},
+		{"America/St_Johns", 48.95, -54.6},
+		{"America/Winnipeg", 49.9, -97.14},
+		{"America/Winnipeg", 53.82, -101.25},
+		{"America/Winnipeg", 56.0, -96.0},
+		{"America/Winnipeg", 49.77, -94.49},
+		{"America/Regina", 50.45, -104.61},
+		{"America/Regina", 52.13, -106.67},
+		{"America/Regina", 55.0, -106.0},
+		{"America/Edmonton", 53.55, -113.49},
+		{"America/Edmonton", 51.05, -114.07},
+		{"America/Edmonton", 56.73, -111.38},
+		{"America/Edmonton", 62.45, -114.37},
+		{"America/Vancouver", 49.28, -123.12},
+		{"America/Vancouver", 48.43, -123.37},
+		{"America/Vancouver", 53.92, -122.75},
+		{"America/Vancouver", 50.67, -120.33},
+		{"America/Vancouver", 54.31, -130.32},
+		{"America/Dawson_Creek", 55.76, -120.24},
+		{"America/Whitehorse", 60.72, -135.06},
+		{"America/Iqaluit", 63.75, -68.52},
+		{"America/Rankin_Inlet", 62.81, -92.09},
+		{"America/Cambridge_Bay", 69.12, -105.06},
+	},
+	"ES": []zoneReference{
+		{"Europe/Madrid", 40.42, -3.7},
+		{"Europe/Madrid", 41.39, 2.17},
+		{"Europe/Madrid", 37.39, -5.98},
+		{"Europe/Madrid", 43.36, -8.41},
+		{"Europe/Madrid", 39.57, 2.65},
+		{"Atlantic/Canary", 28.12, -15.43},
+		{"Atlantic/Canary", 28.47, -16.25},
+		{"Africa/Ceuta", 35.89, -5.32},
+		{"Africa/Ceuta", 35.29, -2.94},
+	},
+	"MX": []zoneReference{
+		{"America/Mexico_City", 19.43, -99.13},
+		{"America/Mexico_City", 20.67, -103.35},
+		{"America/Monterrey", 25.69, -100.32},
+		{"America/Merida", 20.97, -89.62},
+		{"America/Cancun", 21.16, -86.85},
+		{"America/Chihuahua", 28.63, -106.09},
+		{"America/Mazatlan", 23.25, -106.41},
+		{"America/Hermosillo", 29.07, -110.96},
+		{"America/Tijuana", 32.51, -117.04},
+	},
+	"US": []zoneReference{
+		{"America/New_York", 40.71, -74.01},
+		{"America/New_York", 42.36, -71.06},
+		{"America/New_York", 38.9, -77.04},
+		{"America/New_York", 33.75, -84.39},
+		{"America/New_York", 25.76, -80.19},
+		{"America/New_York", 39.96, -83.0},
+		{"America/New_York", 35.23, -80.84},
+		{"America/Detroit", 42.33, -83.05},
+		{"America/Detroit", 44.76, -85.62},
+		{"America/Indiana/Indianapolis", 39.77, -86.16},
+		{"America/Kentucky/Louisville", 38.25, -85.76},
+		{"America/Chicago", 41.88, -87.63},
+		{"America/Chicago", 32.78, -96.8},
+		{"America/Chicago", 29.76, -95.37},
+		{"America/Chicago", 44.98, -93.27},
+		{"America/Chicago", 39.1, -94.58},
+		{"America/Chicago", 29.95, -90.07},
+		{"America/Chicago", 36.16, -86.78},
+		{"America/Chicago", 43.04, -87.91},
+		{"America/Chicago", 46.81, -100.78},
+		{"America/Chicago", 41.26, -95.94},
+		{"America/Chicago", 30.27, -97.74},
+		{"America/Chicago", 30.44, -87.2},
+		{"America/Denver", 39.74, -104.99},
+		{"America/Denver", 40.76, -111.89},
+		{"America/Denver", 35.08, -106.65},
+		{"America/Denver", 45.78, -108.5},
+		{"America/Denver", 41.14, -104.82},
+		{"America/Denver", 31.76, -106.49},
+		{"America/Denver", 44.08, -103.23},
+		{"America/Boise", 43.62, -116.2},
+		{"America/Phoenix", 33.45, -112.07},
+		{"America/Phoenix", 32.22, -110.97},
+		{"America/Los_Angeles", 34.05, -118.24},
+		{"America/Los_Angeles", 37.77, -122.42},
+		{"America/Los_Angeles", 47.61, -122.33},
+		{"America/Los_Angeles", 45.52, -122.68},
+		{"America/Los_Angeles", 36.17, -115.14},
+		{"America/Los_Angeles", 47.66, -117.43},
+		{"America/Anchorage", 61.22, -149.9},
+		{"America/Anchorage", 64.84, -147.72},
+		{"America/Juneau", 58.3, -134.42},
+		{"Pacific/Honolulu", 21.31, -157.86},
+		{"America/Puerto_Rico", 18.47, -66.11},
+	},
+}
+
+// LookupTimeZone finds the IANA time zone of a location in a country. For
+// countries with more than one time zone, this is the zone of the nearest
+// reference point, so locations close to a zone boundary may be wrong. An
+// empty string is returned for countries which are unknown.
+func LookupTimeZone(country string, latitude, longitude float32) string {
+	if zone, found := countryTimeZones[country]; found {
+		return zone
+	}
+	references, found := zoneReferences[country]
+	if !found {
+		return ""
+	}
+	if latitude == 0 && longitude == 0 {
+		return references[0].zone
+	}
+
+	zone := references[0].zone
+	nearest := math.MaxFloat64
+	for _, ref := range references {
+		if distance := approximateDistance(float64(latitude), float64(longitude), ref.latitude, ref.longitude); distance < nearest {
+			nearest = distance
+			zone = ref.zone
+		}
+	}
+	return zone
+}
+
+// GetLocalTime gets the UTC offset, daylight savings flag and local time of
+// a time zone at the given instant. Nil is returned if the zone is unknown.
+func GetLocalTime(timeZone string, now time.Time) *LocalTimeInfo {
+	if len(timeZone) == 0 {
+		return nil
+	}
+	location := loadLocation(timeZone)
+	if location == nil {
+		return nil
+	}
+	local := now.In(location)
+	_, offset := local.Zone()
+	return &LocalTimeInfo{
+		UTCOffset:        local.Format("-07:00"),
+		UTCOffsetSeconds: offset,
+		DST:              local.IsDST(),
+		LocalTime:        local.Format(time.RFC3339),
+	}
+}
+
+// locations caches the loaded time zones by name, and nil for the unknown
+// ones, since loading a zone reads the zone database.
+var locations sync.Map
+
+// loadLocation loads the time zone, or gets nil if it is unknown.
+func loadLocation(timeZone string) *time.Location {
+	if location, found := locations.Load(timeZone); found {
+		return location.(*time.Location)
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		location = nil
+	}
+	locations.Store(timeZone, location)
+	return location
+}
+
+// approximateDistance is the squared equirectangular distance between two
+// points, which is good enough to compare distances within a country.
+func approximateDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	x := (lon2 - lon1) * math.Cos((lat1+lat2)*math.Pi/360)
+	y := lat2 - lat1
+	return x*x + y*y
+}
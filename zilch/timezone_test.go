@@ -0,0 +1,59 @@
+package zilch
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_LookupTimeZone(t *testing.T) {
+	testZone := func(country string, lat, lon float32, expected string) {
+		if zone := LookupTimeZone(country, lat, lon); zone != expected {
+			t.Errorf("%s %v/%v was in %s, expected %s", country, lat, lon, zone, expected)
+		}
+	}
+
+	testZone("DE", 51.4667, 13.8667, "Europe/Berlin")
+	testZone("JP", 0, 0, "Asia/Tokyo")
+	testZone("CA", 54.766, -111.7174, "America/Edmonton")
+	testZone("CA", 44.0, -79.0, "America/Toronto")
+	testZone("CA", 49.1, -122.8, "America/Vancouver")
+	testZone("AU", -35.3049, 149.1412, "Australia/Sydney")
+	testZone("AU", -31.95, 115.9, "Australia/Perth")
+	testZone("BR", -9.9805, -66.8439, "America/Rio_Branco")
+	testZone("ES", 28.1, -15.5, "Atlantic/Canary")
+	testZone("US", 38.78, -77.17, "America/New_York")
+	testZone("US", 0, 0, "America/New_York")
+	testZone("XX", 10, 10, "")
+}
+
+func Test_GetLocalTime(t *testing.T) {
+	summer := time.Date(2014, time.July, 1, 12, 0, 0, 0, time.UTC)
+	winter := time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	if lt := GetLocalTime("America/Chicago", summer); lt == nil {
+		t.Error("America/Chicago should be a known zone")
+	} else if lt.UTCOffset != "-05:00" || lt.UTCOffsetSeconds != -18000 || !lt.DST || lt.LocalTime != "2014-07-01T07:00:00-05:00" {
+		t.Errorf("Wrong summer time: %v", *lt)
+	}
+	if lt := GetLocalTime("America/Chicago", winter); lt == nil {
+		t.Error("America/Chicago should be a known zone")
+	} else if lt.UTCOffset != "-06:00" || lt.DST {
+		t.Errorf("Wrong winter time: %v", *lt)
+	}
+	if lt := GetLocalTime("Asia/Kolkata", winter); lt == nil || lt.UTCOffset != "+05:30" {
+		t.Errorf("Wrong Kolkata time: %v", lt)
+	}
+	if GetLocalTime("", winter) != nil || GetLocalTime("Nowhere/Special", winter) != nil {
+		t.Error("Unknown zones should not have a local time")
+	}
+}
+
+func Test_LoadLocation_Cached(t *testing.T) {
+	first := loadLocation("Europe/Berlin")
+	if first == nil || first.String() != "Europe/Berlin" || loadLocation("Europe/Berlin") != first {
+		t.Errorf("Expected the same location each time: %v", first)
+	}
+	if loadLocation("Nowhere/Special") != nil || loadLocation("Nowhere/Special") != nil {
+		t.Error("Unknown zones should not have a location")
+	}
+}
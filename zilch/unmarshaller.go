@@ -0,0 +1,377 @@
+package zilch
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// xmlZipEntry has the same fields as the ZipEntry, with the tags needed to
+// read back the XML written by ZipEntry.toXML.
+type xmlZipEntry struct {
+	ZipCode            string
+	Type               string
+	City               string
+	AcceptableCities   []string `xml:"AcceptableCities>City"`
+	UnacceptableCities []string `xml:"UnacceptableCities>City"`
+	County             string
+	State              string
+	StateName          string
+	Country            string
+	CountryName        string
+	TimeZone           string
+	AreaCodes          []string `xml:"AreaCodes>AreaCode"`
+	Latitude           float32
+	Longitude          float32
+	LocalTime          *LocalTimeInfo `json:",omitempty"`
+}
+
+type xmlQueryResult struct {
+	ResultsReturned int
+	TotalFound      int
+	StartIndex      int
+	EndIndex        int
+	Facets          []Facet       `xml:"Facets>Facet"`
+	ZipCodeEntries  []xmlZipEntry `xml:"ZipCodeEntries>ZipCodeEntry"`
+}
+
+// UnmarshalQueryResult reads a QueryResult written in any of the formats
+// supported by QueryResult.Marshal. The CSV, TSV, KML and GPX formats do not
+// include the paging details, so the ResultsReturned and EndIndex are the
+// number of zip codes read. KML and GPX only include the zip code and its
+// coordinates.
+func UnmarshalQueryResult(format string, data []byte) (QueryResult, error) {
+	var q QueryResult
+	var err error
+
+	format = strings.ToUpper(format)
+	switch format {
+	case "JS", "JSON":
+		err = json.Unmarshal(data, &q)
+	case "XML":
+		var x xmlQueryResult
+		if err = xml.Unmarshal(data, &x); err == nil {
+			q = QueryResult{ResultsReturned: x.ResultsReturned, TotalFound: x.TotalFound, StartIndex: x.StartIndex, EndIndex: x.EndIndex, Facets: x.Facets, ZipCodeEntries: make([]ZipEntry, 0, len(x.ZipCodeEntries))}
+			for _, entry := range x.ZipCodeEntries {
+				q.ZipCodeEntries = append(q.ZipCodeEntries, ZipEntry(entry))
+			}
+		}
+	case "YAML":
+		err = convertYAML(data, &q)
+	case "MSGPACK":
+		err = convertMsgPack(data, &q)
+	case "GEOJSON":
+		q, err = unmarshalGeoJSONQueryResult(data)
+	case "CSV", "TSV":
+		delimiter := ','
+		if format == "TSV" {
+			delimiter = '\t'
+		}
+		q.ZipCodeEntries, err = unmarshalDelimited(data, delimiter)
+		q.setPaging()
+	case "KML", "GPX":
+		q.ZipCodeEntries, err = unmarshalPlacemarks(format, data)
+		q.setPaging()
+	default:
+		return q, invalidFormatError(format)
+	}
+	if err != nil {
+		return q, fmt.Errorf("Invalid %s query result: %v", format, err)
+	}
+	return q, nil
+}
+
+func (q *QueryResult) setPaging() {
+	q.ResultsReturned = len(q.ZipCodeEntries)
+	q.TotalFound = len(q.ZipCodeEntries)
+	if len(q.ZipCodeEntries) > 0 {
+		q.StartIndex = 1
+		q.EndIndex = len(q.ZipCodeEntries)
+	}
+}
+
+// UnmarshalDistributions reads the distribution entries written in any of
+// the formats supported by DistributionMarshaller.Marshal.
+func UnmarshalDistributions(format string, data []byte) ([]DistributionEntry, error) {
+	var d []DistributionEntry
+	var err error
+
+	format = strings.ToUpper(format)
+	switch format {
+	case "JS", "JSON":
+		err = json.Unmarshal(data, &d)
+	case "XML":
+		var x struct {
+			Entries []DistributionEntry `xml:"DistributionEntry"`
+		}
+		err = xml.Unmarshal(data, &x)
+		d = x.Entries
+	case "YAML":
+		var y struct {
+			DistributionEntries []DistributionEntry
+		}
+		err = convertYAML(data, &y)
+		d = y.DistributionEntries
+	case "MSGPACK":
+		err = convertMsgPack(data, &d)
+	case "GEOJSON":
+		var collection GeoJSONFeatureCollection
+		if err = json.Unmarshal(data, &collection); err == nil {
+			d = make([]DistributionEntry, len(collection.Features))
+			for i, feature := range collection.Features {
+				if err = convertJSON(feature.Properties, &d[i]); err != nil {
+					break
+				}
+			}
+		}
+	default:
+		return d, invalidFormatError(format)
+	}
+	if err != nil {
+		return d, fmt.Errorf("Invalid %s distribution: %v", format, err)
+	}
+	return d, nil
+}
+
+// UnmarshalCountryEntries reads the country entries written in any of the
+// formats supported by CountryEntryMarshaller.Marshal.
+func UnmarshalCountryEntries(format string, data []byte) ([]CountryEntry, error) {
+	var c []CountryEntry
+	var err error
+
+	format = strings.ToUpper(format)
+	switch format {
+	case "JS", "JSON":
+		err = json.Unmarshal(data, &c)
+	case "XML":
+		var x struct {
+			Entries []CountryEntry `xml:"CountryEntry"`
+		}
+		err = xml.Unmarshal(data, &x)
+		c = x.Entries
+	case "YAML":
+		err = convertYAML(data, &c)
+	case "MSGPACK":
+		err = convertMsgPack(data, &c)
+	case "GEOJSON":
+		c, err = unmarshalGeoJSONCountries(data)
+	default:
+		return c, invalidFormatError(format)
+	}
+	if err != nil {
+		return c, fmt.Errorf("Invalid %s country list: %v", format, err)
+	}
+	return c, nil
+}
+
+// UnmarshalError reads the body of an error response written in any of the
+// formats supported by Error.Marshal.
+func UnmarshalError(format string, data []byte) (Error, error) {
+	var e Error
+	var err error
+
+	format = strings.ToUpper(format)
+	switch format {
+	case "JS", "JSON":
+		err = json.Unmarshal(data, &e)
+	case "XML":
+		err = xml.Unmarshal(data, &e)
+	case "YAML":
+		err = convertYAML(data, &e)
+	case "MSGPACK":
+		err = convertMsgPack(data, &e)
+	default:
+		return e, invalidFormatError(format)
+	}
+	if err != nil {
+		return e, fmt.Errorf("Invalid %s error: %v", format, err)
+	}
+	return e, nil
+}
+
+// convertJSON converts the maps and slices read from YAML, MessagePack or
+// GeoJSON properties into a data object, through its JSON form.
+func convertJSON(v interface{}, target interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func convertYAML(data []byte, target interface{}) error {
+	v, err := parseYAML(string(data))
+	if err != nil {
+		return err
+	}
+	return convertJSON(v, target)
+}
+
+func convertMsgPack(data []byte, target interface{}) error {
+	v, err := decodeMsgPack(data)
+	if err != nil {
+		return err
+	}
+	return convertJSON(v, target)
+}
+
+func unmarshalDelimited(data []byte, delimiter rune) ([]ZipEntry, error) {
+	ch := make(chan ZipEntry)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ZipEntryReader{}.readDelimited(bytes.NewReader(data), delimiter, ch)
+	}()
+
+	entries := make([]ZipEntry, 0)
+	for entry := range ch {
+		entries = append(entries, entry)
+	}
+	return entries, <-errCh
+}
+
+func unmarshalPlacemarks(format string, data []byte) ([]ZipEntry, error) {
+	entries := make([]ZipEntry, 0)
+	if format == "GPX" {
+		var gpx struct {
+			Waypoints []struct {
+				Latitude  float32 `xml:"lat,attr"`
+				Longitude float32 `xml:"lon,attr"`
+				Name      string  `xml:"name"`
+			} `xml:"wpt"`
+		}
+		if err := xml.Unmarshal(data, &gpx); err != nil {
+			return nil, err
+		}
+		for _, wpt := range gpx.Waypoints {
+			entries = append(entries, ZipEntry{ZipCode: wpt.Name, Latitude: wpt.Latitude, Longitude: wpt.Longitude})
+		}
+		return entries, nil
+	}
+
+	var kml struct {
+		Placemarks []struct {
+			Name        string `xml:"name"`
+			Coordinates string `xml:"Point>coordinates"`
+		} `xml:"Document>Placemark"`
+		Folders []struct {
+			Placemarks []struct {
+				Name        string `xml:"name"`
+				Coordinates string `xml:"Point>coordinates"`
+			} `xml:"Placemark"`
+		} `xml:"Document>Folder"`
+	}
+	if err := xml.Unmarshal(data, &kml); err != nil {
+		return nil, err
+	}
+	placemarks := kml.Placemarks
+	for _, folder := range kml.Folders {
+		placemarks = append(placemarks, folder.Placemarks...)
+	}
+	for _, placemark := range placemarks {
+		entry := ZipEntry{ZipCode: placemark.Name}
+		coordinates := strings.Split(strings.TrimSpace(placemark.Coordinates), ",")
+		if len(coordinates) < 2 {
+			return nil, fmt.Errorf("Invalid coordinates: %s", placemark.Coordinates)
+		}
+		lon, err := strconv.ParseFloat(coordinates[0], 32)
+		if err != nil {
+			return nil, err
+		}
+		lat, err := strconv.ParseFloat(coordinates[1], 32)
+		if err != nil {
+			return nil, err
+		}
+		entry.Latitude, entry.Longitude = float32(lat), float32(lon)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// pointCoordinates gets the latitude and longitude of a Point geometry.
+func (g *GeoJSONGeometry) pointCoordinates() (float32, float32) {
+	if g == nil || g.Type != "Point" {
+		return 0, 0
+	}
+	coordinates, ok := g.Coordinates.([]interface{})
+	if !ok || len(coordinates) < 2 {
+		return 0, 0
+	}
+	lon, _ := coordinates[0].(float64)
+	lat, _ := coordinates[1].(float64)
+	return float32(lat), float32(lon)
+}
+
+func unmarshalGeoJSONQueryResult(data []byte) (QueryResult, error) {
+	var q QueryResult
+	var collection GeoJSONFeatureCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return q, err
+	}
+
+	q.ZipCodeEntries = make([]ZipEntry, len(collection.Features))
+	for i, feature := range collection.Features {
+		entry := &q.ZipCodeEntries[i]
+		if err := convertJSON(feature.Properties, entry); err != nil {
+			return q, err
+		}
+		entry.Latitude, entry.Longitude = feature.Geometry.pointCoordinates()
+	}
+	q.setPaging()
+	for _, paging := range []struct {
+		value  *int
+		target *int
+	}{
+		{collection.ResultsReturned, &q.ResultsReturned},
+		{collection.TotalFound, &q.TotalFound},
+		{collection.StartIndex, &q.StartIndex},
+		{collection.EndIndex, &q.EndIndex},
+	} {
+		if paging.value != nil {
+			*paging.target = *paging.value
+		}
+	}
+	return q, nil
+}
+
+func unmarshalGeoJSONCountries(data []byte) ([]CountryEntry, error) {
+	var collection GeoJSONFeatureCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, err
+	}
+
+	countries := make([]CountryEntry, 0)
+	for _, feature := range collection.Features {
+		lat, lon := feature.Geometry.pointCoordinates()
+		var bounds BoundingBox
+		if len(feature.BBox) == 4 {
+			bounds = BoundingBox{feature.BBox[3], feature.BBox[0], feature.BBox[1], feature.BBox[2]}
+		}
+
+		switch feature.Properties["Type"] {
+		case "Country":
+			var country CountryEntry
+			if err := convertJSON(feature.Properties, &country); err != nil {
+				return nil, err
+			}
+			country.Latitude, country.Longitude, country.Bounds = lat, lon, bounds
+			country.States = make([]StateEntry, 0)
+			countries = append(countries, country)
+		case "State":
+			var state StateEntry
+			if err := convertJSON(feature.Properties, &state); err != nil {
+				return nil, err
+			}
+			state.Latitude, state.Longitude, state.Bounds = lat, lon, bounds
+			if len(countries) == 0 || countries[len(countries)-1].Country != feature.Properties["Country"] {
+				return nil, fmt.Errorf("State %s is not after its country", state.State)
+			}
+			countries[len(countries)-1].States = append(countries[len(countries)-1].States, state)
+		default:
+			return nil, fmt.Errorf("Unknown feature type: %v", feature.Properties["Type"])
+		}
+	}
+	return countries, nil
+}
@@ -0,0 +1,189 @@
+package zilch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testUnmarshalQueryResult() QueryResult {
+	return QueryResult{
+		ResultsReturned: 2,
+		TotalFound:      12,
+		StartIndex:      3,
+		EndIndex:        4,
+		Facets:          []Facet{Facet{"State", []FacetValue{FacetValue{"VA", 10}, FacetValue{"DC", 2}}}},
+		ZipCodeEntries: []ZipEntry{
+			ZipEntry{
+				ZipCode:            "22151",
+				Type:               "STANDARD",
+				City:               "Springfield",
+				AcceptableCities:   []string{"N Springfield", "North: Springfield, VA"},
+				UnacceptableCities: []string{"N Springfld"},
+				County:             "Fairfax <County> & \"Co\"",
+				State:              "VA",
+				StateName:          "Virginia",
+				Country:            "US",
+				CountryName:        "United States of America",
+				TimeZone:           "America/New_York",
+				AreaCodes:          []string{"703", "202"},
+				Latitude:           float32(38.78),
+				Longitude:          float32(-77.17),
+				LocalTime:          &LocalTimeInfo{"-04:00", -14400, true, "2026-10-19T06:00:00-04:00"},
+			},
+			ZipEntry{
+				ZipCode:            "20010",
+				Type:               "PO BOX",
+				City:               "Washington",
+				AcceptableCities:   []string{},
+				UnacceptableCities: []string{},
+				State:              "DC",
+				StateName:          "District of Columbia",
+				Country:            "US",
+				CountryName:        "United States of America",
+				TimeZone:           "America/New_York",
+				AreaCodes:          []string{},
+			},
+		},
+	}
+}
+
+// normalizeEntries replaces missing lists with empty lists, since some
+// formats can not tell them apart.
+func normalizeEntries(entries []ZipEntry) []ZipEntry {
+	normalized := make([]ZipEntry, len(entries))
+	for i, entry := range entries {
+		for _, list := range []*[]string{&entry.AcceptableCities, &entry.UnacceptableCities, &entry.AreaCodes} {
+			if *list == nil {
+				*list = []string{}
+			}
+		}
+		normalized[i] = entry
+	}
+	return normalized
+}
+
+func Test_Unmarshal_QueryResult(t *testing.T) {
+	q := testUnmarshalQueryResult()
+
+	for _, format := range []string{"JSON", "XML", "YAML", "MSGPACK", "GEOJSON", "CSV", "TSV"} {
+		data, err := q.Marshal(format)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		found, err := UnmarshalQueryResult(format, []byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+
+		expected := q
+		switch format {
+		case "GEOJSON":
+			expected.Facets = nil
+		case "CSV", "TSV":
+			expected = QueryResult{ResultsReturned: 2, TotalFound: 2, StartIndex: 1, EndIndex: 2, ZipCodeEntries: make([]ZipEntry, 2)}
+			copy(expected.ZipCodeEntries, q.ZipCodeEntries)
+			expected.ZipCodeEntries[0].LocalTime = nil
+			// the reader splits primary cities which contain a comma
+			expected.ZipCodeEntries[0].AcceptableCities = []string{"N Springfield", "North: Springfield", "VA"}
+		}
+		expected.ZipCodeEntries = normalizeEntries(expected.ZipCodeEntries)
+		found.ZipCodeEntries = normalizeEntries(found.ZipCodeEntries)
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("Wrong %s round trip\nFound:\n%v\n\nExpecting:\n%v\n", format, found, expected)
+		}
+	}
+}
+
+func Test_Unmarshal_QueryResult_Placemarks(t *testing.T) {
+	q := testUnmarshalQueryResult()
+
+	for _, format := range []string{"KML", "GPX"} {
+		for _, group := range []string{"", "State"} {
+			data, err := q.MarshalGrouped(format, group)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			found, err := UnmarshalQueryResult(format, []byte(data))
+			if err != nil {
+				t.Errorf("%s: %v", format, err)
+				continue
+			}
+			expected := []ZipEntry{ZipEntry{ZipCode: "22151", Latitude: 38.78, Longitude: -77.17}}
+			if found.ResultsReturned != 1 || !reflect.DeepEqual(found.ZipCodeEntries, expected) {
+				t.Errorf("Wrong %s round trip: %v", format, found)
+			}
+		}
+	}
+}
+
+func Test_Unmarshal_Distributions(t *testing.T) {
+	d := []DistributionEntry{
+		DistributionEntry{Latitude: 38, Longitude: -78, ZipCodes: 12},
+		DistributionEntry{Latitude: 0.433, Longitude: 0.25, ZipCodes: 70000, Resolution: 0.5, Grid: HexGrid},
+	}
+
+	for _, format := range []string{"JSON", "XML", "YAML", "MSGPACK", "GEOJSON"} {
+		data, err := DistributionMarshaller(d).Marshal(format)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if found, err := UnmarshalDistributions(format, []byte(data)); err != nil {
+			t.Errorf("%s: %v", format, err)
+		} else if !reflect.DeepEqual(found, d) {
+			t.Errorf("Wrong %s round trip\nFound:\n%v\n\nExpecting:\n%v\n", format, found, d)
+		}
+	}
+}
+
+func Test_Unmarshal_CountryEntries(t *testing.T) {
+	c := []CountryEntry{
+		CountryEntry{
+			Country:     "US",
+			CountryName: "United States of America",
+			ZipCodes:    uint32(421),
+			Latitude:    float32(39.5),
+			Longitude:   float32(-77.25),
+			Bounds:      BoundingBox{42.25, -83.5, 36.5, -75},
+			Coverage:    float32(0.5),
+			States: []StateEntry{
+				StateEntry{State: "VA", StateName: "Virginia", ZipCodes: 100, Latitude: 37.75, Longitude: -78.5, Bounds: BoundingBox{39.5, -83.5, 36.5, -75.25}, Coverage: 1},
+				StateEntry{State: "PA", StateName: "Pennsylvania", ZipCodes: uint32(321)},
+			},
+		},
+		CountryEntry{
+			Country:     "NO",
+			CountryName: "Norway",
+			ZipCodes:    uint32(5),
+			States:      []StateEntry{StateEntry{State: "03", StateName: "Oslo", ZipCodes: 5}},
+		},
+	}
+
+	for _, format := range []string{"JSON", "XML", "YAML", "MSGPACK", "GEOJSON"} {
+		data, err := CountryEntryMarshaller(c).Marshal(format)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if found, err := UnmarshalCountryEntries(format, []byte(data)); err != nil {
+			t.Errorf("%s: %v", format, err)
+		} else if !reflect.DeepEqual(found, c) {
+			t.Errorf("Wrong %s round trip\nFound:\n%v\n\nExpecting:\n%v\n", format, found, c)
+		}
+	}
+}
+
+func Test_Unmarshal_Invalid(t *testing.T) {
+	if _, err := UnmarshalQueryResult("blah", []byte("{}")); err == nil || err.Error() != "Invalid format: BLAH" {
+		t.Errorf("Wrong error: %v", err)
+	}
+	if _, err := UnmarshalCountryEntries("YAML", []byte("  - Country: US\n Bad")); err == nil {
+		t.Error("Expected an error for invalid YAML")
+	}
+	if _, err := UnmarshalDistributions("MSGPACK", []byte{0x92, 0x01}); err == nil {
+		t.Error("Expected an error for truncated MessagePack")
+	}
+}
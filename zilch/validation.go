@@ -0,0 +1,214 @@
+package zilch
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	maxCorrections int = 10
+
+	// CityPrimary means the city is the primary city of the zip code.
+	CityPrimary string = "PRIMARY"
+	// CityAcceptable means the city is an acceptable alternative for the zip code.
+	CityAcceptable string = "ACCEPTABLE"
+	// CityUnacceptable means the city is known, but should not be used, for the zip code.
+	CityUnacceptable string = "UNACCEPTABLE"
+	// CityUnknown means the city is not associated with the zip code.
+	CityUnknown string = "UNKNOWN"
+)
+
+// AddressCorrection is a suggested replacement for the zip code, city and
+// state of a submitted address. Corrections with a higher Score are closer
+// to the submitted address.
+type AddressCorrection struct {
+	ZipCode string
+	City    string
+	State   string
+	Country string
+	Score   int
+}
+
+// AddressValidation is the result of checking a zip code, city and state
+// against the database. CityStatus is empty when no city was submitted, and
+// StateMatches is true when no state was submitted. PartialMatch is true when
+// only the outward part of the zip code was found, such as the FSA of a
+// Canadian postal code.
+type AddressValidation struct {
+	ZipCode      string
+	City         string
+	State        string
+	Country      string
+	Valid        bool
+	ZipCodeFound bool
+	PartialMatch bool
+	CityStatus   string
+	StateMatches bool
+	Corrections  []AddressCorrection
+}
+
+// CorrectionSorter sorts the AddressCorrection slice, highest score first.
+type CorrectionSorter []AddressCorrection
+
+func (c CorrectionSorter) Len() int      { return len(c) }
+func (c CorrectionSorter) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c CorrectionSorter) Less(i, j int) bool {
+	if c[i].Score != c[j].Score {
+		return c[i].Score > c[j].Score
+	}
+	if c[i].ZipCode != c[j].ZipCode {
+		return c[i].ZipCode < c[j].ZipCode
+	}
+	return c[i].City < c[j].City
+}
+
+// ValidateAddress checks that the ZipCode, City and State query parameters
+// are consistent with each other in the given Country.
+func (d *Database) ValidateAddress(queryParams map[string]string) (AddressValidation, error) {
+	v := AddressValidation{
+		ZipCode: strings.TrimSpace(queryParams["ZipCode"]),
+		City:    strings.TrimSpace(queryParams["City"]),
+		State:   strings.TrimSpace(queryParams["State"]),
+		Country: strings.ToUpper(strings.TrimSpace(queryParams["Country"])),
+	}
+	if len(v.ZipCode) == 0 {
+		return v, badRequestError(ErrorMissingParameter, "There is no zip code to validate")
+	}
+	if len(v.Country) == 0 {
+		return v, badRequestError(ErrorMissingParameter, "There is no country to validate against")
+	}
+	countryIndex, found := d.CountryIndexMap[v.Country]
+	if !found {
+		return v, notFoundError(ErrorCountryNotFound, "No country %s found", v.Country)
+	}
+
+	entries, partial := countryIndex.matchZipCode(v.ZipCode)
+	v.ZipCodeFound = len(entries) > 0
+	v.PartialMatch = partial
+	v.StateMatches = len(v.State) == 0
+	if len(v.City) > 0 {
+		v.CityStatus = CityUnknown
+	}
+
+	for _, entry := range entries {
+		cityStatus := entry.cityStatus(v.City)
+		stateMatches := len(v.State) == 0 || entry.matchesState(v.State)
+		if cityRank(cityStatus) > cityRank(v.CityStatus) {
+			v.CityStatus = cityStatus
+			v.StateMatches = stateMatches
+		} else if cityStatus == v.CityStatus && stateMatches {
+			v.StateMatches = true
+		}
+	}
+
+	v.Valid = v.ZipCodeFound && v.StateMatches &&
+		(len(v.City) == 0 || v.CityStatus == CityPrimary || v.CityStatus == CityAcceptable)
+
+	if !v.Valid {
+		v.Corrections = countryIndex.findCorrections(v, entries)
+	}
+	return v, nil
+}
+
+func (c CountryIndex) findCorrections(v AddressValidation, zipEntries []ZipEntry) []AddressCorrection {
+	zipKey := batchZipKey(v.ZipCode)
+	corrections := make(map[string]AddressCorrection)
+
+	addCorrection := func(entry ZipEntry, city string) {
+		score := 0
+		if len(v.City) > 0 && strings.EqualFold(city, v.City) {
+			score += 4
+		}
+		if len(v.State) > 0 && entry.matchesState(v.State) {
+			score += 2
+		}
+		if city == entry.City {
+			score++
+		}
+		entryKey := batchZipKey(entry.ZipCode)
+		for i := 0; i < len(entryKey) && i < len(zipKey) && entryKey[i] == zipKey[i]; i++ {
+			score++
+		}
+		key := entry.ZipCode + "|" + city + "|" + entry.State
+		if existing, found := corrections[key]; !found || existing.Score < score {
+			corrections[key] = AddressCorrection{
+				ZipCode: entry.ZipCode,
+				City:    city,
+				State:   entry.State,
+				Country: entry.Country,
+				Score:   score,
+			}
+		}
+	}
+
+	// the cities which are valid for the submitted zip code
+	for _, entry := range zipEntries {
+		addCorrection(entry, entry.City)
+		for _, city := range entry.AcceptableCities {
+			addCorrection(entry, city)
+		}
+	}
+
+	// the zip codes which are valid for the submitted city
+	if len(v.City) > 0 {
+		for _, entry := range c.Entries {
+			if strings.EqualFold(entry.City, v.City) {
+				addCorrection(entry, entry.City)
+			} else {
+				for _, city := range entry.AcceptableCities {
+					if strings.EqualFold(city, v.City) {
+						addCorrection(entry, city)
+					}
+				}
+			}
+		}
+	}
+
+	list := make([]AddressCorrection, 0, len(corrections))
+	for _, correction := range corrections {
+		list = append(list, correction)
+	}
+	sort.Sort(CorrectionSorter(list))
+	if len(list) > maxCorrections {
+		list = list[:maxCorrections]
+	}
+	return list
+}
+
+func (z ZipEntry) cityStatus(city string) string {
+	if len(city) == 0 {
+		return ""
+	}
+	if strings.EqualFold(z.City, city) {
+		return CityPrimary
+	}
+	for _, c := range z.AcceptableCities {
+		if strings.EqualFold(c, city) {
+			return CityAcceptable
+		}
+	}
+	for _, c := range z.UnacceptableCities {
+		if strings.EqualFold(c, city) {
+			return CityUnacceptable
+		}
+	}
+	return CityUnknown
+}
+
+func (z ZipEntry) matchesState(state string) bool {
+	return strings.EqualFold(z.State, state) || strings.EqualFold(z.StateName, state)
+}
+
+func cityRank(status string) int {
+	switch status {
+	case CityPrimary:
+		return 4
+	case CityAcceptable:
+		return 3
+	case CityUnacceptable:
+		return 2
+	case CityUnknown:
+		return 1
+	}
+	return 0
+}
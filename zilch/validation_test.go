@@ -0,0 +1,79 @@
+package zilch
+
+import (
+	"testing"
+)
+
+func Test_ValidateAddress(t *testing.T) {
+	index := CountryIndex{
+		CountryCode: "US",
+		Entries: []ZipEntry{
+			ZipEntry{ZipCode: "22151", City: "Springfield", AcceptableCities: []string{"North Springfield"}, UnacceptableCities: []string{"N Springfld"}, State: "VA", StateName: "Virginia", Country: "US"},
+			ZipEntry{ZipCode: "22152", City: "Springfield", State: "VA", StateName: "Virginia", Country: "US"},
+			ZipEntry{ZipCode: "62701", City: "Springfield", State: "IL", StateName: "Illinois", Country: "US"},
+		},
+	}
+	index.buildZipIndex()
+	database := &Database{CountryIndexMap: map[string]CountryIndex{"US": index}}
+
+	testValidation := func(query map[string]string, valid bool, cityStatus string, stateMatches bool) AddressValidation {
+		v, err := database.ValidateAddress(query)
+		if err != nil {
+			t.Error(err)
+		} else if v.Valid != valid || v.CityStatus != cityStatus || v.StateMatches != stateMatches {
+			t.Errorf("Validation of %v was %v/%v/%v, expected %v/%v/%v", query, v.Valid, v.CityStatus, v.StateMatches, valid, cityStatus, stateMatches)
+		}
+		return v
+	}
+
+	testValidation(map[string]string{"ZipCode": "22151", "City": "springfield", "State": "VA", "Country": "US"}, true, CityPrimary, true)
+	testValidation(map[string]string{"ZipCode": "22151", "City": "North Springfield", "State": "Virginia", "Country": "US"}, true, CityAcceptable, true)
+	testValidation(map[string]string{"ZipCode": "22151", "Country": "US"}, true, "", true)
+	testValidation(map[string]string{"ZipCode": "22151", "City": "Springfield", "Country": " us "}, true, CityPrimary, true)
+
+	v := testValidation(map[string]string{"ZipCode": "22151", "City": "N Springfld", "State": "VA", "Country": "US"}, false, CityUnacceptable, true)
+	if len(v.Corrections) == 0 || v.Corrections[0].City != "Springfield" || v.Corrections[0].ZipCode != "22151" {
+		t.Errorf("Wrong corrections: %v", v.Corrections)
+	}
+
+	v = testValidation(map[string]string{"ZipCode": "22151", "City": "Springfield", "State": "IL", "Country": "US"}, false, CityPrimary, false)
+	if len(v.Corrections) != 4 || v.Corrections[0].State != "VA" || v.Corrections[2].ZipCode != "62701" {
+		t.Errorf("Wrong corrections: %v", v.Corrections)
+	}
+
+	v = testValidation(map[string]string{"ZipCode": "22159", "City": "Springfield", "State": "VA", "Country": "US"}, false, CityUnknown, false)
+	if len(v.Corrections) != 3 || v.Corrections[0].ZipCode != "22151" || v.Corrections[2].ZipCode != "62701" {
+		t.Errorf("Wrong corrections: %v", v.Corrections)
+	}
+
+	if _, err := database.ValidateAddress(map[string]string{"ZipCode": "22151", "Country": "XX"}); err == nil {
+		t.Error("Expected an error for an unknown country")
+	}
+}
+
+func Test_ValidateAddress_Full_Postal_Code(t *testing.T) {
+	index := CountryIndex{
+		CountryCode: "CA",
+		Entries: []ZipEntry{
+			ZipEntry{ZipCode: "T0A", City: "Eastern Alberta", State: "AB", StateName: "Alberta", Country: "CA"},
+			ZipEntry{ZipCode: "T0B", City: "Wainwright Region", State: "AB", StateName: "Alberta", Country: "CA"},
+		},
+	}
+	index.buildZipIndex()
+	database := &Database{CountryIndexMap: map[string]CountryIndex{"CA": index}}
+
+	v, err := database.ValidateAddress(map[string]string{"ZipCode": "T0A 1A0", "State": "AB", "Country": "CA"})
+	if err != nil || !v.Valid || !v.ZipCodeFound || !v.PartialMatch || len(v.Corrections) != 0 {
+		t.Errorf("Wrong validation of a full postal code %v: %v", err, v)
+	}
+
+	v, err = database.ValidateAddress(map[string]string{"ZipCode": "T0A 1A0", "State": "BC", "Country": "CA"})
+	if err != nil || v.Valid || !v.ZipCodeFound || !v.PartialMatch || v.StateMatches {
+		t.Errorf("Wrong validation of a full postal code in another state %v: %v", err, v)
+	}
+
+	v, err = database.ValidateAddress(map[string]string{"ZipCode": "X9X 1A0", "Country": "CA"})
+	if err != nil || v.Valid || v.ZipCodeFound || v.PartialMatch {
+		t.Errorf("Wrong validation of an unknown postal code %v: %v", err, v)
+	}
+}
@@ -23,103 +23,179 @@ func (writer ResponseWriter) getQuery() map[string]string {
 	return query
 }
 
-// SendError sends the supplied error to the user via an HTTP 500 error.
+// getFormat gets the response format from the file extension. Without an
+// extension the format is negotiated from the Accept header, out of the
+// formats supported by the response and the custom formats. When none of
+// them is acceptable a 406 Not Acceptable is sent, and the returned flag is
+// false.
+func (writer ResponseWriter) getFormat(formats []string) (string, bool) {
+	if len(writer.format) > 0 {
+		if f, found := lookupFormat(writer.format); found {
+			return f.Name, true
+		}
+		return strings.ToUpper(writer.format), true
+	}
+	formats = withCustomFormats(formats)
+	writer.ctx.ResponseWriter.Header().Set("Vary", "Accept")
+	format := negotiateFormat(writer.ctx.Request.Header.Get("Accept"), formats)
+	if len(format) == 0 {
+		writer.SendError(Error{406, ErrorNotAcceptable, "Not Acceptable, the supported media types are: " + acceptableMediaTypes(formats)})
+		return format, false
+	}
+	return format, true
+}
+
+// errorFormat gets the format of an error response, which is the requested
+// format when errors can be written in it, and JSON otherwise.
+func (writer ResponseWriter) errorFormat() string {
+	format := strings.ToUpper(writer.format)
+	if len(format) == 0 {
+		writer.ctx.ResponseWriter.Header().Set("Vary", "Accept")
+		format = negotiateFormat(writer.ctx.Request.Header.Get("Accept"), errorFormats)
+	}
+	for _, f := range errorFormats {
+		if f == format {
+			return f
+		}
+	}
+	return "JSON"
+}
+
+// SendError sends the supplied error to the user in the requested format,
+// with the HTTP status of the error. Any error which is not an Error is sent
+// as a 500 Internal Server Error.
 func (writer ResponseWriter) SendError(err error) {
-	writer.ctx.Abort(500, err.Error())
+	e := toError(err)
+	format := writer.errorFormat()
+	response, merr := e.Marshal(format)
+	if merr != nil {
+		writer.ctx.Abort(500, merr.Error())
+		return
+	}
+
+	header := writer.ctx.ResponseWriter.Header()
+	f, _ := lookupFormat(format)
+	header.Set("Content-Type", f.contentType())
+	if e.Status == 503 {
+		header.Set("Retry-After", "5")
+	}
+	// server errors may not last, so they are never cached
+	if e.Status >= 500 {
+		header.Del("ETag")
+		header.Del("Last-Modified")
+		header.Set("Cache-Control", "no-cache")
+	}
+	header.Set("Content-Length", fmt.Sprintf("%v", len(response)))
+	writer.ctx.Abort(e.Status, response)
 }
 
 // SendDistributionResponse sends the response as a list of DistributionEntry
 // objects.
 func (writer ResponseWriter) SendDistributionResponse(d []DistributionEntry) {
-	format := "JSON"
-	if len(writer.format) > 0 {
-		format = strings.ToUpper(writer.format)
-	}
-	dm := DistributionMarshaller(d)
-	response, err := dm.Marshal(format)
-
-	if err != nil {
-		writer.SendError(err)
-	} else {
-		switch format {
-		case "XML":
-			writer.ctx.ContentType("text/xml; charset=utf-8")
-		default:
-			callback := writer.getJsonpCallback()
-			if len(callback) > 0 {
-				writer.ctx.ContentType("application/javascript; charset=utf-8")
-				response = callback + "(" + response + ");"
-			} else {
-				writer.ctx.ContentType("application/json; charset=utf-8")
-			}
-		}
-		writer.compressionFilter(response)
-	}
+	writer.sendResponse(DistributionMarshaller(d), geoFormats, "distribution")
 }
 
 // SendCountryListResponse sends the response as a list of CountryEntry objects.
 func (writer ResponseWriter) SendCountryListResponse(c []CountryEntry) {
-	format := "JSON"
-	if len(writer.format) > 0 {
-		format = strings.ToUpper(writer.format)
-	}
-	cm := CountryEntryMarshaller(c)
-	response, err := cm.Marshal(format)
+	writer.sendResponse(CountryEntryMarshaller(c), geoFormats, "countries")
+}
 
+// SendSuggestionResponse sends the response as a list of Suggestion objects.
+func (writer ResponseWriter) SendSuggestionResponse(s []Suggestion) {
+	writer.sendResponse(SuggestionMarshaller(s), documentFormats, "suggestions")
+}
+
+// SendBatchResponse sends the response as a list of BatchResult objects.
+func (writer ResponseWriter) SendBatchResponse(b []BatchResult) {
+	writer.sendResponse(BatchResultMarshaller(b), documentFormats, "batch")
+}
+
+// SendValidationResponse sends the response to an address validation.
+func (writer ResponseWriter) SendValidationResponse(v AddressValidation) {
+	writer.sendResponse(v, documentFormats, "validation")
+}
+
+// SendFormatValidationResponse sends the response to a postal code format
+// validation.
+func (writer ResponseWriter) SendFormatValidationResponse(v FormatValidation) {
+	writer.sendResponse(v, documentFormats, "validation")
+}
+
+// SendNormalizedResponse sends the canonical form of a postal code.
+func (writer ResponseWriter) SendNormalizedResponse(n NormalizedPostalCode) {
+	writer.sendResponse(n, documentFormats, "normalized")
+}
+
+// SendRegionResponse sends the response as a Region.
+func (writer ResponseWriter) SendRegionResponse(r Region) {
+	writer.sendResponse(r, documentFormats, strings.ToLower(r.Type))
+}
+
+// SendCacheStatsResponse sends the statistics of the caches.
+func (writer ResponseWriter) SendCacheStatsResponse(c []CacheStats) {
+	writer.sendResponse(CacheStatsMarshaller(c), documentFormats, "stats")
+}
+
+// SendQueryResponse sends the response to a query.
+func (writer ResponseWriter) SendQueryResponse(queryResult QueryResult) {
+	format, ok := writer.getFormat(queryFormats)
+	if !ok {
+		return
+	}
+	response, err := queryResult.MarshalGrouped(format, writer.ctx.Request.FormValue("group"))
 	if err != nil {
 		writer.SendError(err)
-	} else {
-		switch format {
-		case "XML":
-			writer.ctx.ContentType("text/xml; charset=utf-8")
-		default:
-			callback := writer.getJsonpCallback()
-			if len(callback) > 0 {
-				writer.ctx.ContentType("application/javascript; charset=utf-8")
-				response = callback + "(" + response + ");"
-			} else {
-				writer.ctx.ContentType("application/json; charset=utf-8")
-			}
-		}
-		writer.compressionFilter(response)
+		return
 	}
+	// CSV and TSV downloads are named so that they can be loaded as resources
+	fileName := namedFile("zip_codes")
+	if format == "CSV" || format == "TSV" {
+		fileName = queryResult.exportFileName
+	}
+	writer.send(format, response, fileName)
 }
 
-// SendQueryResponse sends the response to a query.
-func (writer ResponseWriter) SendQueryResponse(queryResult QueryResult) {
-	if response, err := writer.marshalQueryResponse(queryResult); err == nil {
-		writer.compressionFilter(response)
+// sendResponse marshals the response into the requested format, which is one
+// of the formats of the response or a custom format, and sends it. Formats
+// which are downloaded are named after the name.
+func (writer ResponseWriter) sendResponse(m Marshaller, formats []string, name string) {
+	format, ok := writer.getFormat(formats)
+	if !ok {
+		return
+	}
+	if response, err := m.Marshal(format); err == nil {
+		writer.send(format, response, namedFile(name))
 	} else {
 		writer.SendError(err)
 	}
 }
 
-func (writer ResponseWriter) marshalQueryResponse(queryResult QueryResult) (string, error) {
-	format := "JSON"
-	if len(writer.format) > 0 {
-		format = strings.ToUpper(writer.format)
+// send sends a marshalled response with the content type of its format,
+// wrapping JSON in the JSONP callback when there is one. The fileName gets
+// the name of a download from the extension of its format.
+func (writer ResponseWriter) send(format, response string, fileName func(extension string) string) {
+	f, _ := lookupFormat(format)
+	callback := writer.getJsonpCallback()
+	if f.Name == "JSON" && len(callback) > 0 {
+		writer.ctx.ContentType("application/javascript; charset=utf-8")
+		response = callback + "(" + response + ");"
+	} else {
+		writer.ctx.ContentType(f.contentType())
+	}
+	if f.Attachment {
+		writer.setAttachment(fileName(f.Extensions[0]))
 	}
-	response, err := queryResult.Marshal(format)
+	writer.compressionFilter(response)
+}
 
-	if err != nil {
-		return response, err
-	}
-
-	switch format {
-	case "XML":
-		writer.ctx.ContentType("text/xml; charset=utf-8")
-	case "YAML":
-		writer.ctx.ContentType("text/yaml; charset=utf-8")
-	default:
-		callback := writer.getJsonpCallback()
-		if len(callback) > 0 {
-			writer.ctx.ContentType("application/javascript; charset=utf-8")
-			response = callback + "(" + response + ");"
-		} else {
-			writer.ctx.ContentType("application/json; charset=utf-8")
-		}
+func namedFile(name string) func(string) string {
+	return func(extension string) string {
+		return name + "." + extension
 	}
-	return response, err
+}
+
+func (writer ResponseWriter) setAttachment(fileName string) {
+	writer.ctx.ResponseWriter.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
 }
 
 func (writer ResponseWriter) compressionFilter(response string) {
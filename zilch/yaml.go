@@ -0,0 +1,218 @@
+package zilch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a non blank line of a YAML document, without its indentation.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser reads the subset of YAML written by the marshallers: block
+// mappings and sequences, flow sequences of scalars, and plain or double
+// quoted scalars. Mappings become map[string]interface{}, sequences become
+// []interface{} and plain numbers become float64, so that the result can be
+// converted to the data objects through encoding/json.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func parseYAML(data string) (interface{}, error) {
+	p := &yamlParser{}
+	for i, line := range strings.Split(data, "\n") {
+		text := strings.TrimLeft(line, " ")
+		if len(strings.TrimSpace(text)) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{i + 1, len(line) - len(text), strings.TrimRight(text, " \r")})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.parseNode(p.lines[0].indent)
+	if err == nil && p.pos < len(p.lines) {
+		err = fmt.Errorf("Unexpected YAML on line %v: %s", p.lines[p.pos].number, p.lines[p.pos].text)
+	}
+	return v, err
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	if isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	list := make([]interface{}, 0)
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		item := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if len(item) == 0 {
+			p.pos++
+			v, err := p.parseChild(indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		if _, _, isKey := splitYAMLKey(item); !isKey {
+			v, err := parseYAMLValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("%v on line %v", err, line.number)
+			}
+			list = append(list, v)
+			p.pos++
+			continue
+		}
+		// the item is a mapping which starts on the same line as the dash
+		p.lines[p.pos] = yamlLine{line.number, line.indent + len(line.text) - len(item), item}
+		v, err := p.parseMapping(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && !isYAMLSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		key, value, isKey := splitYAMLKey(line.text)
+		if !isKey {
+			return nil, fmt.Errorf("Expected a YAML key on line %v: %s", line.number, line.text)
+		}
+		p.pos++
+		var err error
+		if len(value) == 0 {
+			m[key], err = p.parseChild(indent)
+		} else if m[key], err = parseYAMLValue(value); err != nil {
+			err = fmt.Errorf("%v on line %v", err, line.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		line := p.lines[p.pos]
+		return nil, fmt.Errorf("Unexpected indentation on line %v: %s", line.number, line.text)
+	}
+	return m, nil
+}
+
+// parseChild parses the node nested under a key or dash. A sequence may be
+// at the same indentation as its key.
+func (p *yamlParser) parseChild(indent int) (interface{}, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent || (next.indent == indent && isYAMLSequenceItem(next.text)) {
+		return p.parseNode(next.indent)
+	}
+	return nil, nil
+}
+
+// splitYAMLKey splits a "key: value" line, where the key may be quoted.
+func splitYAMLKey(text string) (string, string, bool) {
+	key := text
+	rest := ""
+	if strings.HasPrefix(text, `"`) {
+		quoted, err := strconv.QuotedPrefix(text)
+		if err != nil {
+			return "", "", false
+		}
+		if key, err = strconv.Unquote(quoted); err != nil {
+			return "", "", false
+		}
+		rest = text[len(quoted):]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+		rest = rest[1:]
+	} else {
+		i := strings.Index(text, ": ")
+		if i == -1 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", false
+			}
+			i = len(text) - 1
+		}
+		key = text[:i]
+		rest = text[i+1:]
+	}
+	if len(rest) > 0 && rest[0] != ' ' {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(rest), true
+}
+
+func parseYAMLValue(value string) (interface{}, error) {
+	if strings.HasPrefix(value, "[") {
+		return parseYAMLFlowSequence(value)
+	}
+	if strings.HasPrefix(value, `"`) {
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid quoted YAML scalar %s", value)
+		}
+		return s, nil
+	}
+	if i := strings.Index(value, " #"); i != -1 {
+		value = strings.TrimSpace(value[:i])
+	}
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "~":
+		return nil, nil
+	}
+	if strings.ContainsAny(value[:1], "+-.0123456789") {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, nil
+		}
+	}
+	return value, nil
+}
+
+func parseYAMLFlowSequence(value string) (interface{}, error) {
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("Unterminated YAML sequence %s", value)
+	}
+	list := make([]interface{}, 0)
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	for len(rest) > 0 {
+		item := rest
+		if strings.HasPrefix(rest, `"`) {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid quoted YAML scalar in %s", value)
+			}
+			item = quoted
+		} else if i := strings.Index(rest, ","); i != -1 {
+			item = rest[:i]
+		}
+		v, err := parseYAMLValue(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest[len(item):]), ","))
+	}
+	return list, nil
+}
@@ -1,6 +1,8 @@
 package zilch
 
 import (
+	"strings"
+
 	"github.com/hoisie/web"
 )
 
@@ -12,6 +14,13 @@ type ZipCodeController struct {
 // Query controller method to respond to a query.
 func (c ZipCodeController) Query(ctx *web.Context, format string) {
 	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	if writer.isStreamRequest() {
+		writer.SendQueryStream(c.database, writer.getQuery())
+		return
+	}
 	if queryResult, err := c.database.ExecQuery(writer.getQuery()); err == nil {
 		writer.SendQueryResponse(queryResult)
 	} else {
@@ -19,15 +28,205 @@ func (c ZipCodeController) Query(ctx *web.Context, format string) {
 	}
 }
 
+// Suggest controller method to respond to a typeahead query.
+func (c ZipCodeController) Suggest(ctx *web.Context, format string) {
+	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	if suggestions, err := c.database.Suggest(writer.getQuery()); err == nil {
+		writer.SendSuggestionResponse(suggestions)
+	} else {
+		writer.SendError(err)
+	}
+}
+
+// BatchLookup controller method to look up many zip codes at once. The
+// lookups are read from a JSON body, a CSV body, or a CSV file uploaded in
+// the "file" form field.
+func (c ZipCodeController) BatchLookup(ctx *web.Context, format string) {
+	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) {
+		return
+	}
+	contentType := strings.ToLower(ctx.Request.Header.Get("Content-Type"))
+	defaultCountry := ctx.Request.URL.Query().Get("Country")
+
+	var lookups []BatchLookup
+	var err error
+	if strings.Index(contentType, "multipart/form-data") != -1 {
+		file, _, ferr := ctx.Request.FormFile("file")
+		if ferr != nil {
+			writer.SendError(badRequestError(ErrorInvalidBatch, "Invalid batch upload: %v", ferr))
+			return
+		}
+		defer file.Close()
+		lookups, err = ReadBatchLookupsCSV(file, defaultCountry)
+	} else if strings.Index(contentType, "csv") != -1 {
+		lookups, err = ReadBatchLookupsCSV(ctx.Request.Body, defaultCountry)
+	} else {
+		lookups, err = ReadBatchLookupsJSON(ctx.Request.Body)
+	}
+
+	if err != nil {
+		writer.SendError(err)
+	} else {
+		writer.SendBatchResponse(c.database.BatchLookup(lookups))
+	}
+}
+
+// Validate controller method to check the consistency of an address.
+func (c ZipCodeController) Validate(ctx *web.Context, format string) {
+	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	if validation, err := c.database.ValidateAddress(writer.getQuery()); err == nil {
+		writer.SendValidationResponse(validation)
+	} else {
+		writer.SendError(err)
+	}
+}
+
+// ValidateFormat controller method to check that a postal code is well
+// formed for its country.
+func (c ZipCodeController) ValidateFormat(ctx *web.Context, format string) {
+	writer := ResponseWriter{ctx, format}
+	if c.notModified(writer) {
+		return
+	}
+	query := writer.getQuery()
+	if validation, err := ValidatePostalCodeFormat(query["Country"], query["ZipCode"]); err == nil {
+		writer.SendFormatValidationResponse(validation)
+	} else {
+		writer.SendError(err)
+	}
+}
+
+// Normalize controller method to convert a postal code into the canonical
+// form for its country.
+func (c ZipCodeController) Normalize(ctx *web.Context, format string) {
+	writer := ResponseWriter{ctx, format}
+	if c.notModified(writer) {
+		return
+	}
+	query := writer.getQuery()
+	if len(query["ZipCode"]) == 0 || len(query["Country"]) == 0 {
+		writer.SendError(badRequestError(ErrorMissingParameter, "The ZipCode and Country parameters are required"))
+		return
+	}
+	writer.SendNormalizedResponse(NormalizedPostalCode{
+		ZipCode:    query["ZipCode"],
+		Country:    strings.ToUpper(query["Country"]),
+		Normalized: NormalizePostalCode(query["Country"], query["ZipCode"]),
+	})
+}
+
 // GetDistribution controller method to get the distribution response.
 func (c ZipCodeController) GetDistribution(ctx *web.Context, format string) {
 	writer := ResponseWriter{ctx, format}
-	writer.SendDistributionResponse(c.database.GetDistributions())
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	if distributions, err := c.database.FindDistributions(writer.getQuery()); err == nil {
+		writer.SendDistributionResponse(distributions)
+	} else {
+		writer.SendError(err)
+	}
 }
 
 // GetCountries controller method to get the list of countries and country
 // details.
 func (c ZipCodeController) GetCountries(ctx *web.Context, format string) {
 	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
 	writer.SendCountryListResponse(c.database.CountryList)
 }
+
+// GetCountry controller method to get a single country and its states.
+func (c ZipCodeController) GetCountry(ctx *web.Context, country, format string) {
+	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	region, err := c.database.GetCountryRegion(country)
+	c.sendRegion(writer, region, err)
+}
+
+// GetState controller method to get a single state.
+func (c ZipCodeController) GetState(ctx *web.Context, country, state, format string) {
+	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	region, err := c.database.GetStateRegion(country, state)
+	c.sendRegion(writer, region, err)
+}
+
+// GetCounties controller method to get the counties in a state.
+func (c ZipCodeController) GetCounties(ctx *web.Context, country, state, format string) {
+	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	region, err := c.database.GetCountyRegions(country, state)
+	c.sendRegion(writer, region, err)
+}
+
+// GetCities controller method to get the cities in a state.
+func (c ZipCodeController) GetCities(ctx *web.Context, country, state, format string) {
+	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	region, err := c.database.GetCityRegions(country, state)
+	c.sendRegion(writer, region, err)
+}
+
+// GetZipCode controller method to get a single zip code.
+func (c ZipCodeController) GetZipCode(ctx *web.Context, country, zipCode, format string) {
+	writer := ResponseWriter{ctx, format}
+	if !c.loaded(writer) || c.notModified(writer) {
+		return
+	}
+	region, err := c.database.GetZipCodeRegion(country, zipCode)
+	c.sendRegion(writer, region, err)
+}
+
+// GetCacheStats controller method to get the statistics of the query and
+// image caches.
+func (c ZipCodeController) GetCacheStats(ctx *web.Context, format string) {
+	writer := ResponseWriter{ctx, format}
+	writer.SendCacheStatsResponse(c.database.CacheStats())
+}
+
+func (c ZipCodeController) sendRegion(writer ResponseWriter, region Region, err error) {
+	if err == nil {
+		writer.SendRegionResponse(region)
+	} else {
+		writer.SendError(err)
+	}
+}
+
+// loaded sends a 503 Service Unavailable while the database is still being
+// read, and returns whether the database is ready.
+func (c ZipCodeController) loaded(writer ResponseWriter) bool {
+	if !c.database.IsFullyLoaded() {
+		writer.SendError(loadingError)
+		return false
+	}
+	return true
+}
+
+// notModified sends a 304 Not Modified when the client already has the
+// response. Responses with the local time change all the time, so they are
+// never cached.
+func (c ZipCodeController) notModified(writer ResponseWriter) bool {
+	if writer.ctx.Request.FormValue("localtime") == "true" {
+		writer.ctx.ResponseWriter.Header().Set("Cache-Control", "no-cache")
+		return false
+	}
+	return writer.databaseNotModified(c.database)
+}